@@ -13,17 +13,33 @@ type Application struct {
 	APIVersion string `yaml:"apiVersion"`
 	Kind       string `yaml:"kind"`
 	Metadata   struct {
-		Name string `yaml:"name"`
+		Name   string            `yaml:"name"`
+		Labels map[string]string `yaml:"labels,omitempty"`
 	} `yaml:"metadata"`
 	Spec struct {
+		Project     string `yaml:"project,omitempty"`
 		Destination struct {
 			Namespace string `yaml:"namespace"`
+			Server    string `yaml:"server,omitempty"`
+			Name      string `yaml:"name,omitempty"`
 		} `yaml:"destination"`
-		Source  *Source   `yaml:"source,omitempty"`
-		Sources []*Source `yaml:"sources,omitempty"`
+		Source            *Source                     `yaml:"source,omitempty"`
+		Sources           []*Source                   `yaml:"sources,omitempty"`
+		IgnoreDifferences []ResourceIgnoreDifferences `yaml:"ignoreDifferences,omitempty"`
 	} `yaml:"spec"`
 }
 
+// ResourceIgnoreDifferences selects fields of resources Argo CD ignores when comparing them with the cluster
+type ResourceIgnoreDifferences struct {
+	Group                 string   `yaml:"group,omitempty"`
+	Kind                  string   `yaml:"kind"`
+	Name                  string   `yaml:"name,omitempty"`
+	Namespace             string   `yaml:"namespace,omitempty"`
+	JSONPointers          []string `yaml:"jsonPointers,omitempty"`
+	JQPathExpressions     []string `yaml:"jqPathExpressions,omitempty"`
+	ManagedFieldsManagers []string `yaml:"managedFieldsManagers,omitempty"`
+}
+
 // Source represents a source configuration in an ArgoCD Application
 type Source struct {
 	RepoURL        string          `yaml:"repoURL"`
@@ -33,6 +49,7 @@ type Source struct {
 	Ref            string          `yaml:"ref,omitempty"`
 	Helm           HelmSource      `yaml:"helm,omitempty"`
 	Directory      *DirectorySource `yaml:"directory,omitempty"`
+	Plugin         *PluginSource    `yaml:"plugin,omitempty"`
 }
 
 // HelmSource represents Helm-specific configuration
@@ -47,6 +64,27 @@ type DirectorySource struct {
 	Recurse bool `yaml:"recurse,omitempty"`
 }
 
+// PluginSource represents Config Management Plugin settings
+type PluginSource struct {
+	Name       string            `yaml:"name,omitempty"`
+	Env        []EnvEntry        `yaml:"env,omitempty"`
+	Parameters []PluginParameter `yaml:"parameters,omitempty"`
+}
+
+// EnvEntry is an environment variable passed to a Config Management Plugin
+type EnvEntry struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// PluginParameter is a parameter passed to a Config Management Plugin, holding a string, an array or a map
+type PluginParameter struct {
+	Name   string            `yaml:"name" json:"name"`
+	String *string           `yaml:"string,omitempty" json:"string,omitempty"`
+	Array  []string          `yaml:"array,omitempty" json:"array,omitempty"`
+	Map    map[string]string `yaml:"map,omitempty" json:"map,omitempty"`
+}
+
 // LoadApplications loads and parses ArgoCD Application CRDs from a file
 func LoadApplications(path string) ([]Application, error) {
 	content, err := os.ReadFile(path)
@@ -54,6 +92,11 @@ func LoadApplications(path string) ([]Application, error) {
 		return nil, fmt.Errorf("applications file %s not found: %w", path, err)
 	}
 
+	return ParseApplications(content, path)
+}
+
+// ParseApplications parses ArgoCD Application CRDs from multi-document YAML content read from source
+func ParseApplications(content []byte, source string) ([]Application, error) {
 	// Split the file by YAML document separator
 	documents := strings.Split(string(content), "---")
 	applications := []Application{}
@@ -65,7 +108,7 @@ func LoadApplications(path string) ([]Application, error) {
 
 		var manifest Application
 		if err := yaml.Unmarshal([]byte(doc), &manifest); err != nil {
-			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+			return nil, fmt.Errorf("failed to parse %s: %w", source, err)
 		}
 
 		if manifest.Kind == "Application" && strings.HasPrefix(manifest.APIVersion, "argoproj.io/") {
@@ -85,6 +128,14 @@ func (app *Application) GetEffectiveNamespace() string {
 	return namespace
 }
 
+// GetEffectiveProject returns the project of the application, which is "default" if not specified
+func (app *Application) GetEffectiveProject() string {
+	if app.Spec.Project == "" {
+		return "default"
+	}
+	return app.Spec.Project
+}
+
 // GetSources returns all sources for the application
 func (app *Application) GetSources() []*Source {
 	var sources []*Source
@@ -111,6 +162,11 @@ func (s *Source) IsDirectory() bool {
 	return s.Directory != nil
 }
 
+// IsPlugin returns true if this source is rendered by a Config Management Plugin
+func (s *Source) IsPlugin() bool {
+	return s.Plugin != nil
+}
+
 // GetEffectiveReleaseName returns the release name to use, defaulting to the application name if not specified
 func (s *Source) GetEffectiveReleaseName(defaultName string) string {
 	if s.Helm.ReleaseName != "" {
@@ -119,6 +175,30 @@ func (s *Source) GetEffectiveReleaseName(defaultName string) string {
 	return defaultName
 }
 
+// GetValueFiles returns the paths of the Helm value files, with any $values prefix removed
+func (s *Source) GetValueFiles() []string {
+	var valueFiles []string
+	for _, valueFile := range s.Helm.ValueFiles {
+		// Remove $values prefix if present
+		if strings.HasPrefix(valueFile, "$values/") {
+			valueFile = strings.Replace(valueFile, "$values/", "", 1)
+		}
+		valueFiles = append(valueFiles, valueFile)
+	}
+	return valueFiles
+}
+
+// String describes the source for messages, e.g. "chart nginx 1.2.3 from https://charts.example.com"
+func (s *Source) String() string {
+	if s.IsHelmChart() {
+		return fmt.Sprintf("chart %s %s from %s", s.Chart, s.TargetRevision, s.RepoURL)
+	}
+	if s.Path != "" {
+		return fmt.Sprintf("path %s of %s", s.Path, s.RepoURL)
+	}
+	return s.RepoURL
+}
+
 // ShouldRecurseDirectory returns true if the directory should be recursively processed
 func (s *Source) ShouldRecurseDirectory() bool {
 	return s.Directory != nil && s.Directory.Recurse
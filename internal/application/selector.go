@@ -0,0 +1,115 @@
+package application
+
+import (
+	"fmt"
+	"path"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Selector selects applications by name, labels, project and destination. Every criterion that is set
+// must match; a selector without criteria selects every application
+type Selector struct {
+	// Names holds glob patterns, at least one of which must match the application name
+	Names []string
+
+	// Labels is matched against the application's metadata.labels
+	Labels labels.Selector
+
+	// Project is the required project
+	Project string
+
+	// DestinationNamespace is the required destination namespace
+	DestinationNamespace string
+
+	// DestinationServer is the required destination server
+	DestinationServer string
+}
+
+// NewSelector creates a selector from name glob patterns, a Kubernetes label selector, a project and
+// a destination. Empty arguments do not restrict the selection
+func NewSelector(names []string, labelSelector, project, destinationNamespace, destinationServer string) (*Selector, error) {
+	for _, name := range names {
+		if _, err := path.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("invalid application name pattern %q: %w", name, err)
+		}
+	}
+
+	selector := &Selector{
+		Names:                names,
+		Project:              project,
+		DestinationNamespace: destinationNamespace,
+		DestinationServer:    destinationServer,
+	}
+
+	if labelSelector != "" {
+		parsed, err := labels.Parse(labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector %q: %w", labelSelector, err)
+		}
+		selector.Labels = parsed
+	}
+
+	return selector, nil
+}
+
+// Empty returns true if the selector selects every application
+func (s *Selector) Empty() bool {
+	return len(s.Names) == 0 && s.Labels == nil && s.Project == "" &&
+		s.DestinationNamespace == "" && s.DestinationServer == ""
+}
+
+// Matches returns true if the application meets every criterion of the selector
+func (s *Selector) Matches(app Application) bool {
+	if len(s.Names) > 0 && !s.matchesName(app.Metadata.Name) {
+		return false
+	}
+	if s.Labels != nil && !s.Labels.Matches(labels.Set(app.Metadata.Labels)) {
+		return false
+	}
+	if s.Project != "" && app.GetEffectiveProject() != s.Project {
+		return false
+	}
+	if s.DestinationNamespace != "" && app.GetEffectiveNamespace() != s.DestinationNamespace {
+		return false
+	}
+	if s.DestinationServer != "" && app.Spec.Destination.Server != s.DestinationServer {
+		return false
+	}
+	return true
+}
+
+// Select returns the applications matching the selector, in their original order. It fails if a name
+// pattern matches none of the applications, as that is most likely a typo
+func (s *Selector) Select(applications []Application) ([]Application, error) {
+	for _, name := range s.Names {
+		found := false
+		for _, app := range applications {
+			if matched, _ := path.Match(name, app.Metadata.Name); matched {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no application matches %q", name)
+		}
+	}
+
+	var selected []Application
+	for _, app := range applications {
+		if s.Matches(app) {
+			selected = append(selected, app)
+		}
+	}
+	return selected, nil
+}
+
+// matchesName returns true if any of the name patterns matches name
+func (s *Selector) matchesName(name string) bool {
+	for _, pattern := range s.Names {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package changes
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/application"
+)
+
+// Set is a set of changed files, stored as absolute paths with symlinks resolved
+type Set struct {
+	// paths holds the absolute paths of all changed files
+	paths map[string]bool
+
+	// ref is the commit the changes were computed against, empty when the paths were supplied directly
+	ref string
+
+	// root is the top-level directory of the git checkout, empty outside of a git checkout
+	root string
+}
+
+// FromGit computes the files changed since the branch point with the given git ref, like git diff ref...HEAD,
+// together with the uncommitted and untracked files. Changes made on ref after the branch point are not included
+func FromGit(ref string) (*Set, error) {
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find git repository: %w", err)
+	}
+
+	mergeBase, err := git("merge-base", ref, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the branch point with %s: %w", ref, err)
+	}
+
+	set := &Set{paths: make(map[string]bool), ref: strings.TrimSpace(mergeBase), root: strings.TrimSpace(root)}
+
+	// Comparing the branch point with the working tree covers both the commits and the uncommitted changes
+	changed, err := git("diff", "--name-only", "--no-renames", set.ref, "--")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files changed since %s: %w", ref, err)
+	}
+
+	untracked, err := git("ls-files", "--others", "--exclude-standard", "--full-name", set.root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list untracked files: %w", err)
+	}
+
+	if err := set.add(strings.NewReader(changed + untracked)); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// FromReader reads changed files from r, one per line. Relative paths are resolved against
+// the top-level directory of the git checkout, or against the working directory outside of one
+func FromReader(r io.Reader) (*Set, error) {
+	set := &Set{paths: make(map[string]bool)}
+
+	if root, err := git("rev-parse", "--show-toplevel"); err == nil {
+		set.root = strings.TrimSpace(root)
+	}
+
+	if err := set.add(r); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// add reads paths from r, one per line, and adds them to the set
+func (s *Set) add(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !filepath.IsAbs(line) && s.root != "" {
+			line = filepath.Join(s.root, line)
+		}
+
+		path, err := canonicalPath(line)
+		if err != nil {
+			return fmt.Errorf("failed to resolve changed path %s: %w", line, err)
+		}
+		s.paths[path] = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read changed paths: %w", err)
+	}
+	return nil
+}
+
+// Len returns the number of changed files
+func (s *Set) Len() int {
+	return len(s.paths)
+}
+
+// Contains returns true if the file at path has changed
+func (s *Set) Contains(path string) bool {
+	absPath, err := canonicalPath(path)
+	if err != nil {
+		return false
+	}
+	return s.paths[absPath]
+}
+
+// ContainsUnder returns true if any file inside the directory dir has changed
+func (s *Set) ContainsUnder(dir string) bool {
+	absDir, err := canonicalPath(dir)
+	if err != nil {
+		return false
+	}
+
+	for path := range s.paths {
+		if path == absDir || strings.HasPrefix(path, absDir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the applications defined in applicationsFile that are affected by the changes:
+// those whose definition changed, whose directory, plugin or local chart source contains a changed file,
+// or whose value files changed
+func (s *Set) Filter(applicationsFile string, applications []application.Application) ([]application.Application, error) {
+	// When the definitions file itself changed, find out which definitions differ from the previous version
+	var previous map[string]application.Application
+	definitionsChanged := s.Contains(applicationsFile)
+	if definitionsChanged && s.ref != "" {
+		var err error
+		previous, err = s.previousApplications(applicationsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var affected []application.Application
+	for _, app := range applications {
+		if definitionsChanged {
+			// Without a previous version to compare with, every definition is considered changed
+			old, ok := previous[app.Metadata.Name]
+			if !ok || !reflect.DeepEqual(old, app) {
+				affected = append(affected, app)
+				continue
+			}
+		}
+
+		if s.affectsSources(app) {
+			affected = append(affected, app)
+		}
+	}
+
+	return affected, nil
+}
+
+// affectsSources returns true if any local input of the application's sources has changed: a file under the path
+// of a directory, plugin or local chart source, where an empty path is the repository root like in Argo CD, or a
+// value file, which is looked up both in the working directory and in the repository root
+func (s *Set) affectsSources(app application.Application) bool {
+	for _, source := range app.GetSources() {
+		if !source.IsHelmChart() && !source.IsValueSource() {
+			dir := source.Path
+			if dir == "" {
+				dir = s.rootDir()
+			}
+			if s.ContainsUnder(dir) {
+				return true
+			}
+		}
+
+		for _, valueFile := range source.GetValueFiles() {
+			if s.Contains(valueFile) {
+				return true
+			}
+			if !filepath.IsAbs(valueFile) && s.root != "" && s.Contains(filepath.Join(s.root, valueFile)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rootDir returns the top-level directory of the git checkout, or the working directory outside of one
+func (s *Set) rootDir() string {
+	if s.root == "" {
+		return "."
+	}
+	return s.root
+}
+
+// previousApplications loads the application definitions from applicationsFile as of the set's git ref
+func (s *Set) previousApplications(applicationsFile string) (map[string]application.Application, error) {
+	absPath, err := canonicalPath(applicationsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", applicationsFile, err)
+	}
+
+	relPath, err := filepath.Rel(s.root, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s within git repository: %w", applicationsFile, err)
+	}
+
+	applications := make(map[string]application.Application)
+
+	// The file did not exist at the ref, so every definition in it is new
+	content, err := git("show", fmt.Sprintf("%s:%s", s.ref, filepath.ToSlash(relPath)))
+	if err != nil {
+		return applications, nil
+	}
+
+	parsed, err := application.ParseApplications([]byte(content), fmt.Sprintf("%s at %s", applicationsFile, s.ref))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, app := range parsed {
+		applications[app.Metadata.Name] = app
+	}
+	return applications, nil
+}
+
+// canonicalPath returns the absolute path of path with symlinks resolved, so that paths compare equal to those
+// below the git top-level directory, which git resolves. For a path that does not exist, such as a deleted
+// file, its deepest existing parent directory is resolved
+func canonicalPath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	dir, rest := absPath, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return absPath, nil
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+}
+
+// git runs a git command in the working directory and returns its output
+func git(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,57 @@
+package changes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Worktree is a temporary checkout of a git ref next to the working tree
+type Worktree struct {
+	// root is the top-level directory of the checkout
+	root string
+
+	// tempDir is the temporary directory holding the checkout
+	tempDir string
+
+	// prefix is the path of the working directory relative to the top-level directory of the repository
+	prefix string
+}
+
+// Checkout checks out ref into a temporary git worktree. Remove must be called once it is no longer needed
+func Checkout(ref string) (*Worktree, error) {
+	prefix, err := git("rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find git repository: %w", err)
+	}
+
+	tempDir, err := os.MkdirTemp("", "argocd-hydrate-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	root := filepath.Join(tempDir, "tree")
+	if _, err := git("worktree", "add", "--detach", root, ref); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("failed to check out %s: %w", ref, err)
+	}
+
+	return &Worktree{root: root, tempDir: tempDir, prefix: strings.TrimSpace(prefix)}, nil
+}
+
+// Dir returns the directory in the checkout that corresponds to the working directory
+func (w *Worktree) Dir() string {
+	return filepath.Join(w.root, filepath.FromSlash(w.prefix))
+}
+
+// Remove deletes the checkout and unregisters it from the repository
+func (w *Worktree) Remove() error {
+	if _, err := git("worktree", "remove", "--force", w.root); err != nil {
+		return fmt.Errorf("failed to remove worktree %s: %w", w.root, err)
+	}
+	if err := os.RemoveAll(w.tempDir); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", w.tempDir, err)
+	}
+	return nil
+}
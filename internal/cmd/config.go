@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/config"
+)
+
+// pathAnnotation marks flags whose values are paths, which are relative to the directory of the configuration
+// file when they are set in it
+const pathAnnotation = "argocd-hydrate/path"
+
+// markPathFlags marks the named flags of a flag set as paths
+func markPathFlags(flags *pflag.FlagSet, names ...string) {
+	for _, name := range names {
+		flag := flags.Lookup(name)
+		if flag.Annotations == nil {
+			flag.Annotations = make(map[string][]string)
+		}
+		flag.Annotations[pathAnnotation] = []string{"true"}
+	}
+}
+
+// setting is an option that can be set by a flag, an environment variable or the configuration file
+type setting struct {
+	// path holds the names of the subcommands declaring the flag, followed by the flag name
+	path []string
+
+	// flag is the flag holding the option's value
+	flag *pflag.Flag
+}
+
+// envName returns the environment variable of the setting, e.g. ARGOCD_HYDRATE_TEMPLATE_FORMAT
+func (s setting) envName() string {
+	name := strings.ReplaceAll(strings.Join(s.path, "_"), "-", "_")
+	return config.EnvPrefix + strings.ToUpper(name)
+}
+
+// settings lists every option of the command tree below root. Options of the root command are
+// top-level keys of the configuration file, those of subcommands live in a section named after them
+func settings(root *cobra.Command) []setting {
+	var result []setting
+
+	var walk func(cmd *cobra.Command, prefix []string)
+	walk = func(cmd *cobra.Command, prefix []string) {
+		cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+			if flag.Name == "help" || flag.Name == "version" || flag.Name == "config" {
+				return
+			}
+			path := append(append([]string{}, prefix...), flag.Name)
+			result = append(result, setting{path: path, flag: flag})
+		})
+
+		for _, sub := range cmd.Commands() {
+			// Commands added by cobra itself have no options worth configuring
+			if sub.Name() == "help" || sub.Name() == "completion" {
+				continue
+			}
+			walk(sub, append(append([]string{}, prefix...), sub.Name()))
+		}
+	}
+	walk(root, nil)
+
+	return result
+}
+
+// loadConfiguration applies the configuration file and ARGOCD_HYDRATE_* environment variables to every
+// option that was not set on the command line, giving the precedence flags > environment > file > defaults
+func loadConfiguration(cmd *cobra.Command, args []string) error {
+	cfg := config.GetConfig()
+
+	// Errors from here on are about the configuration, not the command line usage, and are printed by main
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+
+	// Find the configuration file
+	path := cfg.ConfigFile
+	if configFlag := cmd.Root().PersistentFlags().Lookup("config"); !configFlag.Changed {
+		if env, ok := os.LookupEnv(config.EnvPrefix + "CONFIG"); ok {
+			path = env
+		}
+	}
+	if path == "" {
+		found, err := config.FindFile(".")
+		if err != nil {
+			return err
+		}
+		path = found
+	}
+
+	var file *config.File
+	if path != "" {
+		var err error
+		file, err = config.LoadFile(path)
+		if err != nil {
+			return err
+		}
+		cfg.ConfigFile = path
+	}
+
+	all := settings(cmd.Root())
+	if file != nil {
+		if err := checkFileKeys(file, all, cmd.Root()); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range all {
+		if s.flag.Changed {
+			continue
+		}
+
+		if value, ok := os.LookupEnv(s.envName()); ok {
+			var values []interface{}
+			for _, item := range splitEnvValue(s.flag, value) {
+				values = append(values, item)
+			}
+			if err := setFlag(s.flag, values); err != nil {
+				return fmt.Errorf("invalid value of %s: %w", s.envName(), err)
+			}
+			continue
+		}
+
+		if file == nil {
+			continue
+		}
+		if value, ok := lookupSetting(file.Settings, s.path); ok && value != nil {
+			values, isList := value.([]interface{})
+			if !isList {
+				values = []interface{}{value}
+			} else if _, isSlice := s.flag.Value.(pflag.SliceValue); !isSlice {
+				return fmt.Errorf("invalid value of %s in %s: expected a single value", strings.Join(s.path, "."), file.Path)
+			}
+			if _, isPath := s.flag.Annotations[pathAnnotation]; isPath {
+				for i, value := range values {
+					values[i] = resolveFilePath(file.Path, fmt.Sprint(value))
+				}
+			}
+			if err := setFlag(s.flag, values); err != nil {
+				return fmt.Errorf("invalid value of %s in %s: %w", strings.Join(s.path, "."), file.Path, err)
+			}
+		}
+	}
+
+	// Structured options can only be set in the configuration file
+	if file != nil {
+		cfg.Repositories = file.Repositories
+		cfg.Mirrors = file.Mirrors
+		cfg.Clusters = file.Clusters
+	}
+
+	return nil
+}
+
+// resolveFilePath resolves a relative path set in the configuration file against the directory of the file, so
+// that it means the same from any working directory. Empty paths and "-" for stdin or stdout are kept
+func resolveFilePath(filePath, path string) string {
+	if path == "" || path == "-" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(filePath), path)
+}
+
+// splitEnvValue splits the value of an environment variable into comma-separated items for list options
+func splitEnvValue(flag *pflag.Flag, value string) []string {
+	if _, isSlice := flag.Value.(pflag.SliceValue); !isSlice {
+		return []string{value}
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// setFlag sets the value of a flag without marking it as changed on the command line.
+// List options are replaced by all of the values
+func setFlag(flag *pflag.Flag, values []interface{}) error {
+	if slice, isSlice := flag.Value.(pflag.SliceValue); isSlice {
+		items := make([]string, 0, len(values))
+		for _, value := range values {
+			items = append(items, fmt.Sprint(value))
+		}
+		return slice.Replace(items)
+	}
+
+	for _, value := range values {
+		if err := flag.Value.Set(fmt.Sprint(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupSetting finds the value at path in the settings of a configuration file
+func lookupSetting(settings map[string]interface{}, path []string) (interface{}, bool) {
+	for _, section := range path[:len(path)-1] {
+		nested, ok := settings[section].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		settings = nested
+	}
+
+	value, ok := settings[path[len(path)-1]]
+	return value, ok
+}
+
+// checkFileKeys makes sure every key of a configuration file is a known option or subcommand section,
+// so that typos do not go unnoticed
+func checkFileKeys(file *config.File, all []setting, root *cobra.Command) error {
+	known := make(map[string]bool)
+	for _, s := range all {
+		known[strings.Join(s.path, ".")] = true
+	}
+
+	var check func(settings map[string]interface{}, cmd *cobra.Command, prefix string) error
+	check = func(settings map[string]interface{}, cmd *cobra.Command, prefix string) error {
+		for key, value := range settings {
+			if known[prefix+key] {
+				continue
+			}
+
+			// Otherwise it must be a section holding the options of a subcommand
+			nested, isSection := value.(map[string]interface{})
+			sub := subcommand(cmd, key)
+			if !isSection || sub == nil {
+				return fmt.Errorf("unknown option %s in configuration file %s", prefix+key, file.Path)
+			}
+			if err := check(nested, sub, prefix+key+"."); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return check(file.Settings, root, "")
+}
+
+// subcommand returns the subcommand of cmd with the given name, or nil if there is none
+func subcommand(cmd *cobra.Command, name string) *cobra.Command {
+	for _, sub := range cmd.Commands() {
+		if sub.Name() == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// newConfigCommand creates the config subcommand
+func newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "view",
+		Short: "Print the effective configuration",
+		Long: `Print the effective configuration as YAML, combining flags, ARGOCD_HYDRATE_* environment variables,
+the configuration file and defaults. The output can be used as a configuration file.`,
+		Args: cobra.NoArgs,
+		Run:  runConfigView,
+	})
+
+	return cmd
+}
+
+// runConfigView is the main function for the config view command
+func runConfigView(cmd *cobra.Command, args []string) {
+	cfg := config.GetConfig()
+
+	view := make(map[string]interface{})
+	for _, s := range settings(cmd.Root()) {
+		section := view
+		for _, name := range s.path[:len(s.path)-1] {
+			nested, ok := section[name].(map[string]interface{})
+			if !ok {
+				nested = make(map[string]interface{})
+				section[name] = nested
+			}
+			section = nested
+		}
+		section[s.path[len(s.path)-1]] = flagValue(s.flag)
+	}
+
+	if len(cfg.Repositories) > 0 {
+		view["repositories"] = cfg.Repositories
+	}
+	if len(cfg.Mirrors) > 0 {
+		view["mirrors"] = cfg.Mirrors
+	}
+	if len(cfg.Clusters) > 0 {
+		view["clusters"] = cfg.Clusters
+	}
+
+	content, err := yaml.Marshal(view)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to marshal configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if cfg.ConfigFile != "" {
+		fmt.Printf("# Configuration file: %s\n", cfg.ConfigFile)
+	} else {
+		fmt.Printf("# No configuration file found\n")
+	}
+	os.Stdout.Write(content)
+}
+
+// flagValue returns the value of a flag with its native type, for printing
+func flagValue(flag *pflag.Flag) interface{} {
+	if slice, isSlice := flag.Value.(pflag.SliceValue); isSlice {
+		return slice.GetSlice()
+	}
+
+	switch flag.Value.Type() {
+	case "bool":
+		if value, err := strconv.ParseBool(flag.Value.String()); err == nil {
+			return value
+		}
+	case "int":
+		if value, err := strconv.Atoi(flag.Value.String()); err == nil {
+			return value
+		}
+	}
+	return flag.Value.String()
+}
@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/application"
+	"github.com/kazysgurskas/argocd-hydrate/internal/changes"
+	"github.com/kazysgurskas/argocd-hydrate/internal/config"
+	"github.com/kazysgurskas/argocd-hydrate/internal/diff"
+	"github.com/kazysgurskas/argocd-hydrate/internal/helm"
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+	"github.com/kazysgurskas/argocd-hydrate/internal/index"
+	"github.com/kazysgurskas/argocd-hydrate/internal/logging"
+	"github.com/kazysgurskas/argocd-hydrate/internal/output"
+)
+
+// newDiffCommand creates the diff subcommand, which compares the hydrated manifests with a previous hydration
+func newDiffCommand(cfg *config.Configuration) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff [application-pattern...]",
+		Short: "Show how the hydrated manifests differ from the output directory or another git ref",
+		Long: `Hydrate the selected applications and compare their manifests with the output directory, or with a
+hydration of another git ref checked out in a temporary worktree. Resources are matched by group, kind,
+namespace and name rather than by file, and key order, formatting and comments are ignored. Every changed
+resource is printed as a unified diff, with added, removed and changed counts per application.
+
+With --summary-markdown, the changes are also written as a Markdown report for pull request comments: a
+table of the changed applications with their resource counts and chart version bumps, and a collapsible
+section per application with its resource diffs, each truncated to --summary-max-diff-size bytes.`,
+		Run: runDiff,
+	}
+
+	cmd.Flags().StringVar(&cfg.DiffRef, "ref", cfg.DiffRef,
+		"Compare with a hydration of this git ref instead of the output directory")
+	cmd.Flags().StringVar(&cfg.DiffSummaryMarkdown, "summary-markdown", cfg.DiffSummaryMarkdown,
+		"Write the changes as a Markdown report to this file (\"-\" for stdout, replacing the plain diff)")
+	cmd.Flags().IntVar(&cfg.DiffSummaryMaxDiffSize, "summary-max-diff-size", cfg.DiffSummaryMaxDiffSize,
+		"Truncate each resource diff of the Markdown report to this many bytes, 0 for no limit")
+
+	markPathFlags(cmd.Flags(), "summary-markdown")
+
+	return cmd
+}
+
+// runDiff is the main function for the diff command
+func runDiff(cmd *cobra.Command, args []string) {
+	config := config.GetConfig()
+	logOptions, logger := setupLogging(config)
+
+	// Share the chart cache with the hydration of the other ref, which runs in another directory
+	chartsDir, err := filepath.Abs(config.ChartsDir)
+	if err != nil {
+		logger.Error("Failed to resolve charts directory", "error", err)
+		os.Exit(1)
+	}
+	config.ChartsDir = chartsDir
+
+	helmClient, err := newHelmClient(config)
+	if err != nil {
+		logger.Error("Failed to configure Helm repositories", "error", err)
+		os.Exit(1)
+	}
+
+	options, err := hydrateOptions(config)
+	if err != nil {
+		logger.Error("Invalid manifest processing options", "error", err)
+		os.Exit(1)
+	}
+
+	// Hydrate the working tree
+	applications, err := application.LoadApplications(config.ApplicationsFile)
+	if err != nil {
+		logger.Error("Failed to load applications", "error", err)
+		os.Exit(1)
+	}
+
+	applications, err = selectApplications(logger, config, applications, args)
+	if err != nil {
+		logger.Error("Failed to select applications", "error", err)
+		os.Exit(1)
+	}
+
+	after, ok := renderForDiff(logOptions.New, logger, helmClient, options, config, applications)
+	if !ok {
+		os.Exit(1)
+	}
+
+	// Collect the manifests to compare with
+	var before []diff.Application
+	if config.DiffRef != "" {
+		before, ok = hydrateRef(logOptions, logger, helmClient, options, config, args)
+		if !ok {
+			os.Exit(1)
+		}
+	} else {
+		before, err = readOutputDir(config, applications, args)
+		if err != nil {
+			logger.Error("Failed to read output directory", "dir", config.OutputDir, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Custom resources may be defined by another application, on either side
+	scopes := index.NewScopes(config.ClusterScopedKinds)
+	for _, app := range append(append([]diff.Application{}, before...), after...) {
+		if _, err := scopes.AddCRDs(app.Manifests); err != nil {
+			logger.Error("Failed to read CustomResourceDefinitions", "application", app.Name, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	diffs, err := diff.Compare(before, after, scopes)
+	if err != nil {
+		logger.Error("Failed to compare manifests", "error", err)
+		os.Exit(1)
+	}
+
+	if config.DiffSummaryMarkdown != "-" {
+		diff.Write(os.Stdout, diffs)
+	}
+
+	if err := writeSummary(config, diffs); err != nil {
+		logger.Error("Failed to write Markdown summary", "error", err)
+		os.Exit(1)
+	}
+}
+
+// writeSummary writes the Markdown report of the changes, if one was requested
+func writeSummary(cfg *config.Configuration, diffs []diff.ApplicationDiff) error {
+	if cfg.DiffSummaryMarkdown == "" {
+		return nil
+	}
+
+	if cfg.DiffSummaryMarkdown == "-" {
+		diff.WriteMarkdown(os.Stdout, diffs, cfg.DiffSummaryMaxDiffSize)
+		return nil
+	}
+
+	file, err := os.Create(cfg.DiffSummaryMarkdown)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", cfg.DiffSummaryMarkdown, err)
+	}
+	diff.WriteMarkdown(file, diffs, cfg.DiffSummaryMaxDiffSize)
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", cfg.DiffSummaryMarkdown, err)
+	}
+	return nil
+}
+
+// renderForDiff renders applications in memory for comparison, logging any failures with logger.
+// It returns false if any application failed
+func renderForDiff(newLogger newLoggerFunc, logger *slog.Logger, helmClient *helm.Client, options hydrate.Options, cfg *config.Configuration, applications []application.Application) ([]diff.Application, bool) {
+	rendered, failures := renderApplications(newLogger, helmClient, options, cfg, applications)
+	if len(failures) > 0 {
+		logFailures(logger, failures)
+		return nil, false
+	}
+
+	var apps []diff.Application
+	for _, r := range rendered {
+		apps = append(apps, diff.Application{
+			Name:      r.app.Metadata.Name,
+			Namespace: r.app.GetEffectiveNamespace(),
+			Manifests: r.result.Manifests,
+			Charts:    hydrate.ChartVersions(r.app),
+		})
+	}
+	return apps, true
+}
+
+// hydrateRef hydrates the selected applications as of the configured git ref, in a temporary worktree.
+// Applications or an applications file that do not exist at the ref have no manifests
+func hydrateRef(logOptions logging.Options, logger *slog.Logger, helmClient *helm.Client, options hydrate.Options, cfg *config.Configuration, names []string) ([]diff.Application, bool) {
+	logger.Info("Checking out git ref", "ref", cfg.DiffRef)
+	worktree, err := changes.Checkout(cfg.DiffRef)
+	if err != nil {
+		logger.Error("Failed to check out git ref", "ref", cfg.DiffRef, "error", err)
+		return nil, false
+	}
+	defer func() {
+		if err := worktree.Remove(); err != nil {
+			logger.Warn("Failed to remove worktree", "error", err)
+		}
+	}()
+
+	// Relative paths of the applications and their sources refer to the checkout
+	workingDir, err := os.Getwd()
+	if err != nil {
+		logger.Error("Failed to get working directory", "error", err)
+		return nil, false
+	}
+	if err := os.Chdir(worktree.Dir()); err != nil {
+		logger.Error("Failed to enter worktree", "error", err)
+		return nil, false
+	}
+	defer os.Chdir(workingDir)
+
+	applications, err := application.LoadApplications(cfg.ApplicationsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		logger.Info("Applications file does not exist at git ref", "file", cfg.ApplicationsFile, "ref", cfg.DiffRef)
+		return nil, true
+	}
+	if err != nil {
+		logger.Error("Failed to load applications at git ref", "ref", cfg.DiffRef, "error", err)
+		return nil, false
+	}
+
+	// Patterns need not match anything at the ref, as the applications may be new
+	selector, err := newSelector(cfg, names)
+	if err != nil {
+		logger.Error("Failed to select applications", "error", err)
+		return nil, false
+	}
+	var selected []application.Application
+	for _, app := range applications {
+		if selector.Matches(app) {
+			selected = append(selected, app)
+		}
+	}
+
+	newLogger := func(w io.Writer) *slog.Logger {
+		return logOptions.New(w).With("ref", cfg.DiffRef)
+	}
+	return renderForDiff(newLogger, logger.With("ref", cfg.DiffRef), helmClient, options, cfg, selected)
+}
+
+// readOutputDir reads the manifests of the selected applications from the output directory. Without any
+// selection, the output of applications that are no longer defined is included too
+func readOutputDir(cfg *config.Configuration, applications []application.Application, names []string) ([]diff.Application, error) {
+	var apps []diff.Application
+	defined := make(map[string]bool)
+
+	for _, app := range applications {
+		defined[app.Metadata.Name] = true
+
+		manifests, err := output.ReadApplication(cfg.OutputDir, app.Metadata.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		// The charts of the previous run are recorded in its state
+		state, err := hydrate.ReadState(filepath.Join(cfg.OutputDir, app.Metadata.Name))
+		if err != nil {
+			return nil, err
+		}
+
+		// The output may predate --ignore-differences, so the ignored fields are stripped from this side too
+		if cfg.IgnoreDifferences {
+			manifests, err = hydrate.StripIgnoredDifferences(manifests, app)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		apps = append(apps, diff.Application{
+			Name:      app.Metadata.Name,
+			Namespace: app.GetEffectiveNamespace(),
+			Manifests: manifests,
+			Charts:    state.Charts,
+		})
+	}
+
+	selector, err := newSelector(cfg, names)
+	if err != nil {
+		return nil, err
+	}
+	if !selector.Empty() {
+		return apps, nil
+	}
+
+	existing, err := output.Applications(cfg.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range existing {
+		if defined[name] {
+			continue
+		}
+
+		manifests, err := output.ReadApplication(cfg.OutputDir, name)
+		if err != nil {
+			return nil, err
+		}
+		// The destination namespace of an application that is no longer defined is unknown, so only
+		// resources that set their namespace are keyed by it
+		apps = append(apps, diff.Application{Name: name, Manifests: manifests})
+	}
+
+	return apps, nil
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/application"
+	"github.com/kazysgurskas/argocd-hydrate/internal/config"
+	"github.com/kazysgurskas/argocd-hydrate/internal/helm"
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+	"github.com/kazysgurskas/argocd-hydrate/internal/plugin"
+)
+
+// newHelmClient creates the Helm client of a run, resolving the credential references of the configured repositories
+func newHelmClient(cfg *config.Configuration) (*helm.Client, error) {
+	options := helm.Options{
+		Mirrors:     cfg.Mirrors,
+		Credentials: make(map[string]helm.Credentials),
+	}
+
+	for _, repository := range cfg.Repositories {
+		if repository.UsernameEnv == "" && repository.PasswordEnv == "" {
+			continue
+		}
+
+		var credentials helm.Credentials
+		for _, ref := range []struct {
+			name  string
+			value *string
+		}{
+			{repository.UsernameEnv, &credentials.Username},
+			{repository.PasswordEnv, &credentials.Password},
+		} {
+			if ref.name == "" {
+				continue
+			}
+			value, ok := os.LookupEnv(ref.name)
+			if !ok {
+				return nil, fmt.Errorf("environment variable %s referenced by repository %s is not set", ref.name, repository.URL)
+			}
+			*ref.value = value
+		}
+		options.Credentials[repository.URL] = credentials
+	}
+
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	return helm.NewClient(cfg.ChartsDir, cfg.KubeVersion, options), nil
+}
+
+// hydrateOptions returns the options of the processing of rendered manifests
+func hydrateOptions(cfg *config.Configuration) (hydrate.Options, error) {
+	options := hydrate.Options{IgnoreDifferences: cfg.IgnoreDifferences}
+
+	plugins, err := plugin.NewRegistry(cfg.Plugins, cfg.PluginTimeout)
+	if err != nil {
+		return options, err
+	}
+	options.Plugins = plugins
+
+	if !cfg.Normalise {
+		if len(cfg.RemoveFields) > 0 {
+			return options, fmt.Errorf("--remove-field requires --normalise")
+		}
+		return options, nil
+	}
+
+	normaliser, err := hydrate.NewNormaliser(cfg.RemoveFields)
+	if err != nil {
+		return options, err
+	}
+	options.Normaliser = normaliser
+	return options, nil
+}
+
+// clusterClient returns the Helm client for the destination cluster of an application, using the first
+// cluster profile that matches its destination name or server
+func clusterClient(helmClient *helm.Client, cfg *config.Configuration, app application.Application) *helm.Client {
+	for _, cluster := range cfg.Clusters {
+		if (cluster.Name != "" && cluster.Name == app.Spec.Destination.Name) ||
+			(cluster.Server != "" && cluster.Server == app.Spec.Destination.Server) {
+			return helmClient.ForCluster(cluster.KubeVersion, cluster.APIVersions)
+		}
+	}
+	return helmClient
+}
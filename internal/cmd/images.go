@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/config"
+	"github.com/kazysgurskas/argocd-hydrate/internal/images"
+)
+
+// newImagesCommand creates the images subcommand, which lists the container images of applications
+func newImagesCommand(cfg *config.Configuration) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "images [application-pattern...]",
+		Short: "List the container images the hydrated manifests deploy",
+		Long: `Hydrate the selected applications and list every container image they deploy, de-duplicated, with the
+applications and resources using each, e.g. for vulnerability scanning or pre-seeding a registry mirror. Images are
+read from the containers, init containers and ephemeral containers of Pods, PodTemplates, ReplicationControllers,
+Deployments, StatefulSets, DaemonSets, ReplicaSets, Jobs and CronJobs. Other kinds, such as custom resources,
+are read at the JSONPaths given with --path, which replace the built-in locations of their kind.`,
+		Run: runImages,
+	}
+
+	cmd.Flags().StringVar(&cfg.ImagesFormat, "format", cfg.ImagesFormat,
+		"Format of the image list written to stdout: text, json or csv")
+	cmd.Flags().StringArrayVar(&cfg.ImagePaths, "path", cfg.ImagePaths,
+		"JSONPath of images in a kind, as KIND=JSONPATH with KIND optionally qualified with its API group, e.g. Rollout.argoproj.io={.spec.template.spec.containers[*].image}, can be repeated")
+
+	return cmd
+}
+
+// runImages is the main function for the images command
+func runImages(cmd *cobra.Command, args []string) {
+	config := config.GetConfig()
+	logOptions, logger := setupLogging(config)
+
+	if config.ImagesFormat != images.FormatText && config.ImagesFormat != images.FormatJSON && config.ImagesFormat != images.FormatCSV {
+		logger.Error(fmt.Sprintf("--format must be %s, %s or %s, got %q", images.FormatText, images.FormatJSON, images.FormatCSV, config.ImagesFormat))
+		os.Exit(1)
+	}
+
+	extractor, err := images.NewExtractor(config.ImagePaths)
+	if err != nil {
+		logger.Error("Failed to configure image paths", "error", err)
+		os.Exit(1)
+	}
+
+	// Collect every image before writing, so a failure never leaves a partial list behind
+	_, rendered, failures := renderSelected(logOptions, logger, config, args)
+	if len(failures) > 0 {
+		logFailures(logger, failures)
+		os.Exit(1)
+	}
+
+	scopes := newScopes(logger, config, rendered)
+	inventory := images.NewInventory()
+	for _, r := range rendered {
+		for _, manifest := range r.result.Manifests {
+			found, err := extractor.Extract(manifest)
+			if err != nil {
+				logger.Error("Failed to extract images", "application", r.app.Metadata.Name, "error", err)
+				os.Exit(1)
+			}
+
+			key := scopes.KeyOf(manifest, r.app.GetEffectiveNamespace())
+			for _, image := range found {
+				inventory.Add(image, r.app.Metadata.Name, key.String())
+			}
+		}
+	}
+
+	if err := images.Write(os.Stdout, inventory.Images(), config.ImagesFormat); err != nil {
+		logger.Error("Failed to write images", "error", err)
+		os.Exit(1)
+	}
+}
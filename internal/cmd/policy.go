@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/config"
+	"github.com/kazysgurskas/argocd-hydrate/internal/policy"
+)
+
+// newPolicyCommand creates the policy subcommand, which checks rendered manifests against policy rules
+func newPolicyCommand(cfg *config.Configuration) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy [application-pattern...]",
+		Short: "Check the hydrated manifests against policy rules",
+		Long: `Hydrate the selected applications and evaluate the CEL expression of every matching rule of the --rules file
+against each resource, without writing to the output directory. An expression sees the resource as object and
+its application as application (name, namespace, project and labels), and must evaluate to true. Besides the
+standard library, the string extensions and the Kubernetes list, regex, URL and quantity libraries are available.
+
+A rule applies to every resource unless its match lists kinds (e.g. Deployment or Deployment.apps), namespace
+patterns or application patterns. A resource is exempted from rules by listing their names, or *, in its
+` + policy.ExemptionAnnotation + ` annotation. Violations are reported with the severity of their rule, and the
+command fails if any violation is at least as severe as --fail-on.
+
+Example rules file:
+
+  rules:
+  - name: no-latest-tag
+    severity: error
+    match:
+      kinds: [Deployment, StatefulSet, DaemonSet]
+    expression: >
+      object.spec.template.spec.containers.all(c, !c.image.endsWith(':latest'))
+    message: Containers must not use the latest tag`,
+		Run: runPolicy,
+	}
+
+	cmd.Flags().StringVar(&cfg.PolicyRulesFile, "rules", cfg.PolicyRulesFile,
+		"Path to the file containing the policy rules")
+	cmd.Flags().StringVar(&cfg.PolicyFailOn, "fail-on", cfg.PolicyFailOn,
+		"Least severity of violations that fail the command: info, warning or error")
+
+	markPathFlags(cmd.Flags(), "rules")
+
+	return cmd
+}
+
+// runPolicy is the main function for the policy command
+func runPolicy(cmd *cobra.Command, args []string) {
+	config := config.GetConfig()
+	logOptions, logger := setupLogging(config)
+
+	failLevel, err := policy.SeverityLevel(config.PolicyFailOn)
+	if err != nil {
+		logger.Error("Invalid --fail-on", "error", err)
+		os.Exit(1)
+	}
+
+	if config.PolicyRulesFile == "" {
+		logger.Error("--rules is required")
+		os.Exit(1)
+	}
+	engine, err := policy.LoadRules(config.PolicyRulesFile)
+	if err != nil {
+		logger.Error("Failed to load policy rules", "error", err)
+		os.Exit(1)
+	}
+
+	_, rendered, failures := renderSelected(logOptions, logger, config, args)
+	scopes := newScopes(logger, config, rendered)
+
+	counts := make(map[string]int)
+	var exempted int
+	failed := false
+	for _, r := range rendered {
+		appLogger := logger.With("application", r.app.Metadata.Name)
+
+		for _, manifest := range r.result.Manifests {
+			key := scopes.KeyOf(manifest, r.app.GetEffectiveNamespace())
+			resourceLogger := appLogger.With("resource", key.String())
+			if manifest.Source != nil {
+				resourceLogger = resourceLogger.With("source", manifest.Source.String())
+			}
+
+			result, err := engine.Evaluate(manifest, r.app, key.Namespace)
+			if err != nil {
+				resourceLogger.Error("Failed to evaluate policy rules", "error", err)
+				failed = true
+				continue
+			}
+
+			for _, rule := range result.Exempted {
+				resourceLogger.Debug("Resource is exempted from rule", "rule", rule)
+			}
+			exempted += len(result.Exempted)
+
+			for _, violation := range result.Violations {
+				resourceLogger.Log(context.Background(), violationLevel(violation.Severity), "Policy violation",
+					"rule", violation.Rule, "severity", violation.Severity, "message", violation.Message)
+				counts[violation.Severity]++
+
+				if level, _ := policy.SeverityLevel(violation.Severity); level >= failLevel {
+					failed = true
+				}
+			}
+		}
+	}
+
+	logger.Info("Policy check finished", "errors", counts[policy.SeverityError],
+		"warnings", counts[policy.SeverityWarning], "infos", counts[policy.SeverityInfo], "exempted", exempted)
+
+	if len(failures) > 0 {
+		logFailures(logger, failures)
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// violationLevel returns the log level of violations of a severity
+func violationLevel(severity string) slog.Level {
+	switch severity {
+	case policy.SeverityError:
+		return slog.LevelError
+	case policy.SeverityWarning:
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
@@ -2,27 +2,69 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
 
 	"github.com/spf13/cobra"
 
 	"github.com/kazysgurskas/argocd-hydrate/internal/config"
+	"github.com/kazysgurskas/argocd-hydrate/internal/logging"
 )
 
-// getVersion returns the version information filled by LDFLAGS during build
-func getVersion() struct {
+// Version information, set with -ldflags "-X github.com/kazysgurskas/argocd-hydrate/internal/cmd.version=..." during build
+var (
+	version   = "dev"
+	gitCommit = "none"
+	buildDate = "unknown"
+)
+
+// versionInfo describes the build of the tool
+type versionInfo struct {
 	Version   string
 	GitCommit string
 	BuildDate string
-} {
-	return struct {
-		Version   string
-		GitCommit string
-		BuildDate string
-	}{
-		Version:   "dev",
-		GitCommit: "none",
-		BuildDate: "unknown",
+}
+
+// getVersion returns the version information filled by LDFLAGS during build. Values that were not set are
+// taken from the build information Go embeds, such as the module version of go install and the VCS revision
+func getVersion() versionInfo {
+	info := versionInfo{Version: version, GitCommit: gitCommit, BuildDate: buildDate}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "dev" && buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+		info.Version = buildInfo.Main.Version
 	}
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.GitCommit == "none" {
+				info.GitCommit = setting.Value
+			}
+		case "vcs.time":
+			if info.BuildDate == "unknown" {
+				info.BuildDate = setting.Value
+			}
+		case "vcs.modified":
+			if setting.Value == "true" && gitCommit == "none" {
+				info.GitCommit += "-dirty"
+			}
+		}
+	}
+	return info
+}
+
+// toolVersion identifies the build of the tool for fingerprints, including the commit of development builds,
+// whose version alone does not change with the code
+func toolVersion() string {
+	info := getVersion()
+	if info.Version == "dev" && info.GitCommit != "none" {
+		return info.Version + "+" + info.GitCommit
+	}
+	return info.Version
 }
 
 // New creates a new root command for the argocd-hydrate CLI
@@ -38,12 +80,15 @@ func New() *cobra.Command {
 		Short: "Hydrate ArgoCD applications into Kubernetes manifests",
 		Long: `ArgoCD Hydrate - Render ArgoCD Applications into Kubernetes manifests
 
-This tool takes ArgoCD Application custom resources and renders Kubernetes manifests. It supports applications that use Helm charts
-and directory-based sources.`,
-		Run: runHydrate,
+This tool takes ArgoCD Application custom resources and renders Kubernetes manifests. It supports applications that use Helm charts,
+directory-based sources and Config Management Plugins.`,
+		PersistentPreRunE: loadConfiguration,
+		Run:               runHydrate,
 	}
 
 	// Define flags - these modify the configuration we just created and set as global
+	cmd.PersistentFlags().StringVar(&cfg.ConfigFile, "config", cfg.ConfigFile,
+		fmt.Sprintf("Path to the configuration file, by default %s in the working directory or its nearest parent directory", config.FileName))
 	cmd.PersistentFlags().StringVar(&cfg.ApplicationsFile, "applications", cfg.ApplicationsFile,
 		"Path to the file containing ArgoCD Application CRDs")
 	cmd.PersistentFlags().StringVar(&cfg.OutputDir, "output", cfg.OutputDir,
@@ -52,6 +97,73 @@ and directory-based sources.`,
 		"Directory for storing downloaded Helm charts")
 	cmd.PersistentFlags().StringVar(&cfg.KubeVersion, "kube-version", cfg.KubeVersion,
 		"Kubernetes version to use for rendering Helm charts")
+	cmd.PersistentFlags().IntVar(&cfg.Parallelism, "parallelism", cfg.Parallelism,
+		"Number of applications to hydrate concurrently")
+	cmd.PersistentFlags().BoolVar(&cfg.Force, "force", cfg.Force,
+		"Re-render all applications, even those whose inputs are unchanged")
+	cmd.PersistentFlags().StringVar(&cfg.ChangedSince, "changed-since", cfg.ChangedSince,
+		"Only hydrate applications affected by changes since the branch point with this git ref, including uncommitted changes")
+	cmd.PersistentFlags().StringVar(&cfg.ChangedFiles, "changed-files", cfg.ChangedFiles,
+		"Only hydrate applications affected by the paths listed in this file (\"-\" for stdin), relative to the git repository root")
+
+	cmd.PersistentFlags().StringArrayVar(&cfg.Apps, "app", cfg.Apps,
+		"Only hydrate applications whose name matches this glob pattern, can be repeated")
+	cmd.PersistentFlags().StringVarP(&cfg.Selector, "selector", "l", cfg.Selector,
+		"Only hydrate applications whose labels match this Kubernetes label selector, e.g. team=web,tier!=db")
+	cmd.PersistentFlags().StringVar(&cfg.Project, "project", cfg.Project,
+		"Only hydrate applications of this project")
+	cmd.PersistentFlags().StringVar(&cfg.DestinationNamespace, "destination-namespace", cfg.DestinationNamespace,
+		"Only hydrate applications deploying to this namespace")
+	cmd.PersistentFlags().StringVar(&cfg.DestinationServer, "destination-server", cfg.DestinationServer,
+		"Only hydrate applications deploying to this cluster server URL")
+
+	cmd.PersistentFlags().StringVar(&cfg.Prune, "prune", cfg.Prune,
+		"Remove stale files and application directories from the output directory: true, false or dry-run")
+	cmd.PersistentFlags().Lookup("prune").NoOptDefVal = "true"
+
+	cmd.PersistentFlags().BoolVar(&cfg.Check, "check", cfg.Check,
+		fmt.Sprintf("Fail with exit code %d if the output directory is out of date, without writing to it", exitOutOfDate))
+
+	cmd.PersistentFlags().StringVar(&cfg.Layout, "layout", cfg.Layout,
+		"Output layout within each application directory: tree (<namespace>/<Kind>.<group>/<name>.yaml), manifest (manifest.yaml), kind (<Kind>.yaml), flat (<kind>-<name>.yaml) or template")
+	cmd.PersistentFlags().StringVar(&cfg.LayoutTemplate, "layout-template", cfg.LayoutTemplate,
+		"Go template for file paths of the template layout, with fields .App, .Namespace, .Group, .Version, .Kind and .Name")
+	cmd.PersistentFlags().BoolVar(&cfg.IgnoreDifferences, "ignore-differences", cfg.IgnoreDifferences,
+		"Strip the fields excluded by each application's spec.ignoreDifferences (jsonPointers and jqPathExpressions) from rendered manifests, and from both sides of diff")
+	cmd.PersistentFlags().BoolVar(&cfg.Normalise, "normalise", cfg.Normalise,
+		"Normalise rendered manifests: order keys canonically, remove null and empty fields and comments, and use consistent indentation and quoting")
+	cmd.PersistentFlags().StringArrayVar(&cfg.RemoveFields, "remove-field", cfg.RemoveFields,
+		"JSON pointer of a volatile field removed from every manifest when normalising, e.g. /metadata/labels/helm.sh~1chart, can be repeated")
+
+	cmd.PersistentFlags().StringArrayVar(&cfg.Plugins, "plugin", cfg.Plugins,
+		"Path to a ConfigManagementPlugin definition (plugin.yaml), or a directory of them, used to render sources with spec.source.plugin, can be repeated")
+	cmd.PersistentFlags().DurationVar(&cfg.PluginTimeout, "plugin-timeout", cfg.PluginTimeout,
+		"Time each plugin command may run before it is stopped, 0 for no limit")
+
+	cmd.PersistentFlags().StringArrayVar(&cfg.ClusterScopedKinds, "cluster-scoped-kind", cfg.ClusterScopedKinds,
+		"Kind qualified with its API group, e.g. ClusterIssuer.cert-manager.io, of cluster-scoped custom resources whose CRD no application renders, can be repeated")
+	cmd.PersistentFlags().BoolVar(&cfg.FailOnDuplicates, "fail-on-duplicates", cfg.FailOnDuplicates,
+		"Fail if a resource is rendered by more than one application")
+
+	cmd.PersistentFlags().BoolVar(&cfg.KeepGoing, "keep-going", cfg.KeepGoing,
+		"Hydrate all applications even if some fail, write the output of those that succeeded and summarise the failures")
+	cmd.PersistentFlags().StringVar(&cfg.ReportFile, "report", cfg.ReportFile,
+		"Write a JSON report with per-application results to this file")
+
+	cmd.PersistentFlags().StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel,
+		"Minimum level of log records written to stderr: debug, info, warn or error")
+	cmd.PersistentFlags().StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat,
+		"Format of log records written to stderr: text or json")
+
+	markPathFlags(cmd.PersistentFlags(), "applications", "output", "charts-dir", "changed-files", "plugin", "report")
+
+	// Add subcommands
+	cmd.AddCommand(newTemplateCommand(cfg))
+	cmd.AddCommand(newDiffCommand(cfg))
+	cmd.AddCommand(newValidateCommand(cfg))
+	cmd.AddCommand(newPolicyCommand(cfg))
+	cmd.AddCommand(newImagesCommand(cfg))
+	cmd.AddCommand(newConfigCommand())
 
 	// Add examples
 	cmd.Example = `  # Use default values
@@ -61,7 +173,70 @@ and directory-based sources.`,
   argocd-hydrate --applications=apps/applications.yaml --output=rendered
 
   # Specify custom charts directory
-  argocd-hydrate --charts-dir=/path/to/charts`
+  argocd-hydrate --charts-dir=/path/to/charts
+
+  # Hydrate up to 8 applications concurrently
+  argocd-hydrate --parallelism=8
+
+  # Re-render every application, ignoring unchanged fingerprints
+  argocd-hydrate --force
+
+  # Only hydrate some applications, by name pattern or by label
+  argocd-hydrate --app='frontend-*' --app=backend
+  argocd-hydrate --selector='team=web,env in (prod,staging)'
+
+  # Only hydrate applications affected by changes since the main branch
+  argocd-hydrate --changed-since=origin/main
+
+  # Only hydrate applications affected by a list of changed paths
+  git diff --name-only HEAD~1 | argocd-hydrate --changed-files=-
+
+  # Remove manifests that are no longer rendered, or only list them
+  argocd-hydrate --prune
+  argocd-hydrate --prune=dry-run
+
+  # Fail if the committed output is out of date, e.g. in CI
+  argocd-hydrate --check --prune
+
+  # Write a single manifest.yaml per application
+  argocd-hydrate --layout=manifest
+
+  # Build file paths from a template
+  argocd-hydrate --layout=template --layout-template='{{.Namespace}}/{{.Kind}}.{{.Group}}/{{.Name}}.yaml'
+
+  # Normalise manifests, dropping the chart label and config checksums to reduce diff noise
+  argocd-hydrate --normalise --remove-field=/metadata/labels/helm.sh~1chart \
+    --remove-field=/spec/template/metadata/annotations/checksum~1config
+
+  # Render plugin sources with local Config Management Plugin definitions
+  argocd-hydrate --plugin=plugins/ --plugin-timeout=2m
+
+  # Leave out the fields Argo CD ignores via each application's spec.ignoreDifferences
+  argocd-hydrate --ignore-differences
+
+  # Hydrate every application, reporting all failures at the end
+  argocd-hydrate --keep-going --report=report.json
+
+  # Only log warnings and errors, as JSON
+  argocd-hydrate --log-level=warn --log-format=json
+
+  # Show how the manifests change compared with the main branch
+  argocd-hydrate diff --ref=origin/main
+
+  # Validate the rendered manifests against downloaded Kubernetes JSON schemas, rejecting unknown fields
+  argocd-hydrate validate --schema-dir=schemas --strict
+
+  # Enforce the rules of a policy file, failing on warnings too
+  argocd-hydrate policy --rules=policy.yaml --fail-on=warning
+
+  # List the container images of every application as CSV, including those of Argo Rollouts
+  argocd-hydrate images --format=csv --path='Rollout.argoproj.io={.spec.template.spec.containers[*].image}'
+
+  # Print the configuration combined from flags, ARGOCD_HYDRATE_* variables and .argocd-hydrate.yaml
+  argocd-hydrate config view
+
+  # Compare the manifests of an application with the cluster
+  argocd-hydrate template my-app | kubectl diff -f -`
 
 	// Use version information from LDFLAGS
 	versionInfo := getVersion()
@@ -71,3 +246,14 @@ and directory-based sources.`,
 
 	return cmd
 }
+
+// setupLogging creates the logger of a run from the configured log level and format, writing to stderr.
+// It exits if they are invalid
+func setupLogging(cfg *config.Configuration) (logging.Options, *slog.Logger) {
+	options, err := logging.ParseOptions(cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return options, options.New(os.Stderr)
+}
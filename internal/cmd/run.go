@@ -1,93 +1,678 @@
 package cmd
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/kazysgurskas/argocd-hydrate/internal/application"
+	"github.com/kazysgurskas/argocd-hydrate/internal/changes"
 	"github.com/kazysgurskas/argocd-hydrate/internal/config"
+	"github.com/kazysgurskas/argocd-hydrate/internal/helm"
 	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
-	"github.com/kazysgurskas/argocd-hydrate/pkg/util"
+	"github.com/kazysgurskas/argocd-hydrate/internal/index"
+	"github.com/kazysgurskas/argocd-hydrate/internal/logging"
+	"github.com/kazysgurskas/argocd-hydrate/internal/output"
+	"github.com/kazysgurskas/argocd-hydrate/internal/report"
 )
 
+// exitOutOfDate is the exit code of --check when the output directory is out of date
+const exitOutOfDate = 2
+
 // runHydrate is the main function for the hydrate command
 func runHydrate(cmd *cobra.Command, args []string) {
 	config := config.GetConfig()
+	logOptions, logger := setupLogging(config)
+
+	if config.Parallelism < 1 {
+		logger.Error(fmt.Sprintf("--parallelism must be at least 1, got %d", config.Parallelism))
+		os.Exit(1)
+	}
+
+	if config.Prune != output.PruneOff && config.Prune != output.PruneOn && config.Prune != output.PruneDryRun {
+		logger.Error(fmt.Sprintf("--prune must be one of %s, %s or %s, got %q", output.PruneOn, output.PruneOff, output.PruneDryRun, config.Prune))
+		os.Exit(1)
+	}
+
+	layout, err := output.NewLayout(config.Layout, config.LayoutTemplate)
+	if err != nil {
+		logger.Error("Invalid layout", "error", err)
+		os.Exit(1)
+	}
+
+	options, err := hydrateOptions(config)
+	if err != nil {
+		logger.Error("Invalid manifest processing options", "error", err)
+		os.Exit(1)
+	}
 
 	// Load applications
 	applications, err := application.LoadApplications(config.ApplicationsFile)
 	if err != nil {
-		fmt.Printf("Error loading applications: %v\n", err)
+		logger.Error("Failed to load applications", "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("Found ArgoCD applications", "count", len(applications), "file", config.ApplicationsFile)
+
+	// Remember every defined application, so that pruning never removes the output of one that was filtered out
+	var applicationNames []string
+	for _, app := range applications {
+		applicationNames = append(applicationNames, app.Metadata.Name)
+	}
+
+	// Limit hydration to the selected applications
+	applications, err = selectApplications(logger, config, applications, nil)
+	if err != nil {
+		logger.Error("Failed to select applications", "error", err)
+		os.Exit(1)
+	}
+
+	// Limit hydration to the applications affected by a change set, if one was given
+	if config.ChangedSince != "" || config.ChangedFiles != "" {
+		total := len(applications)
+		applications, err = filterChangedApplications(config, applications)
+		if err != nil {
+			logger.Error("Failed to determine changed applications", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Selected applications affected by changes", "affected", len(applications), "total", total)
+	}
+
+	helmClient, err := newHelmClient(config)
+	if err != nil {
+		logger.Error("Failed to configure Helm repositories", "error", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Found %d ArgoCD application(s) in %s\n", len(applications), config.ApplicationsFile)
+	// Record per-application results, writing the report on every exit from here on
+	recorder := report.NewRecorder(getVersion().Version, config.KubeVersion, applicationNames)
+	exit := func(code int) {
+		writeReport(logger, config, recorder)
+		os.Exit(code)
+	}
+
+	// In check mode, collect the rendered files in memory and compare them with the output directory
+	if config.Check {
+		memory := &output.Memory{}
+		result := hydrateApplications(logOptions, helmClient, layout, options, memory, recorder, applications, config)
+		if len(result.failures) > 0 && !config.KeepGoing {
+			logFailures(logger, result.failures)
+			exit(1)
+		}
+		if reportDuplicates(logger, recorder, result) && config.FailOnDuplicates {
+			logger.Error("Resources are rendered by multiple applications")
+			exit(1)
+		}
+
+		// With --keep-going, the applications that succeeded are still checked
+		code := checkOutput(logger, config, memory.Files(), applicationNames, result.managed, result.produced)
+		if len(result.failures) > 0 {
+			logFailures(logger, result.failures)
+			code = 1
+		}
+		exit(code)
+	}
 
 	// Ensure base output directory exists
 	if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
-		fmt.Printf("Error creating output directory %s: %v\n", config.OutputDir, err)
-		os.Exit(1)
+		logger.Error("Failed to create output directory", "dir", config.OutputDir, "error", err)
+		exit(1)
 	}
 
-	// Process each application
-	for _, app := range applications {
-		fmt.Printf("Processing application: %s\n", app.Metadata.Name)
+	// Render into a staging directory, so the output directory only changes once every application succeeded
+	staging, err := output.NewStaging(config.OutputDir)
+	if err != nil {
+		logger.Error("Failed to create staging directory", "error", err)
+		exit(1)
+	}
 
-		// Create application output directory
-		appOutputDir := filepath.Join(config.OutputDir, app.Metadata.Name)
-		if err := os.MkdirAll(appOutputDir, 0755); err != nil {
-			fmt.Printf("Error creating application directory %s: %v\n", appOutputDir, err)
-			os.Exit(1)
+	result := hydrateApplications(logOptions, helmClient, layout, options, staging, recorder, applications, config)
+	failed := len(result.failures) > 0
+
+	// Resources rendered by several applications would fight over them in the cluster
+	if (!failed || config.KeepGoing) && reportDuplicates(logger, recorder, result) && config.FailOnDuplicates {
+		logger.Error("Resources are rendered by multiple applications")
+		failed = true
+	}
+
+	// Without --keep-going, any failure leaves the output directory untouched
+	if failed && !config.KeepGoing {
+		if err := staging.Discard(); err != nil {
+			logger.Error("Failed to discard staging directory", "error", err)
 		}
+		logFailures(logger, result.failures)
+		logger.Error("Output directory was left unchanged", "dir", config.OutputDir)
+		exit(1)
+	}
 
-		// Render the application
-		manifests, err := hydrate.HydrateFromApplication(app)
+	// Find files that are no longer produced by any application before the previous output is replaced
+	var stale []string
+	if config.Prune != output.PruneOff {
+		stale, err = output.StaleFiles(config.OutputDir, applicationNames, result.managed, result.produced)
 		if err != nil {
-			fmt.Printf("Error hydrating application %s: %v\n", app.Metadata.Name, err)
-			os.Exit(1)
+			logger.Error("Failed to scan output directory", "dir", config.OutputDir, "error", err)
+			if err := staging.Discard(); err != nil {
+				logger.Error("Failed to discard staging directory", "error", err)
+			}
+			exit(1)
+		}
+
+		if config.Prune == output.PruneDryRun {
+			for _, path := range stale {
+				logger.Info("Would prune", "path", filepath.Join(config.OutputDir, path))
+			}
+		}
+	}
+
+	// Swap the staged applications into place, keeping stale files unless they are pruned
+	if err := staging.Commit(config.Prune != output.PruneOn); err != nil {
+		logger.Error("Failed to write output directory", "dir", config.OutputDir, "error", err)
+		if err := staging.Discard(); err != nil {
+			logger.Error("Failed to discard staging directory", "error", err)
+		}
+		exit(1)
+	}
+
+	if config.Prune == output.PruneOn {
+		if err := output.Prune(logger, config.OutputDir, stale, result.managed); err != nil {
+			logger.Error("Failed to prune output directory", "dir", config.OutputDir, "error", err)
+			exit(1)
+		}
+	}
+
+	// With --keep-going, the output of the applications that succeeded has been written
+	if failed {
+		logFailures(logger, result.failures)
+		exit(1)
+	}
+
+	writeReport(logger, config, recorder)
+}
+
+// runResult collects what a run produced across all applications
+type runResult struct {
+	// managed holds the applications whose files are known
+	managed []string
+
+	// produced holds the paths of all known files, relative to the output directory
+	produced map[string]bool
+
+	// resources maps every known resource to the applications rendering it
+	resources *index.Index
+
+	// scopes tells cluster-scoped kinds from namespaced ones, including those of every CRD rendered so far
+	scopes *index.Scopes
+
+	// failures holds every failure of the run
+	failures []failure
+}
+
+// failure is a single failure of an application, attributed to one of its sources where possible
+type failure struct {
+	// app is the name of the failed application
+	app string
+
+	// source describes the failed source, empty when the failure is not specific to a source
+	source string
+
+	// err is the failure itself
+	err error
+}
+
+// newLoggerFunc creates a logger writing to w, giving each application of a worker pool a logger of its own
+type newLoggerFunc func(w io.Writer) *slog.Logger
+
+// forEachApplication calls fn for every application with a pool of --parallelism workers, passing it a logger
+// for the application created with newLogger. With more than one worker, the log records of each application
+// are buffered and printed as a single block. Unless --keep-going is set, no further applications are started
+// once fn failed
+func forEachApplication(newLogger newLoggerFunc, cfg *config.Configuration, applications []application.Application, fn func(logger *slog.Logger, app application.Application) error) {
+	var (
+		wg          sync.WaitGroup
+		outputMutex sync.Mutex
+		failed      atomic.Bool
+	)
+
+	jobs := make(chan application.Application)
+	for i := 0; i < cfg.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for app := range jobs {
+				if failed.Load() && !cfg.KeepGoing {
+					continue
+				}
+
+				// Buffer log records of concurrent applications so each one is printed as a single block
+				var buffer bytes.Buffer
+				logger := newLogger(os.Stderr)
+				if cfg.Parallelism > 1 {
+					logger = newLogger(&buffer)
+				}
+				logger = logger.With("application", app.Metadata.Name)
+
+				if err := fn(logger, app); err != nil {
+					failed.Store(true)
+				}
+
+				outputMutex.Lock()
+				os.Stderr.Write(buffer.Bytes())
+				outputMutex.Unlock()
+			}
+		}()
+	}
+
+	for _, app := range applications {
+		if failed.Load() && !cfg.KeepGoing {
+			break
 		}
+		jobs <- app
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// hydrateApplications hydrates applications with a pool of workers. Unless --keep-going is set, it stops
+// at the first failure. It returns what the applications produced along with every failure
+func hydrateApplications(logOptions logging.Options, helmClient *helm.Client, layout output.Layout, options hydrate.Options, writer output.Writer, recorder *report.Recorder, applications []application.Application, config *config.Configuration) *runResult {
+	var resultMutex sync.Mutex
 
-		// Skip if no manifests were generated
-		if len(manifests) == 0 {
-			fmt.Printf("No manifests generated for application %s\n", app.Metadata.Name)
+	result := &runResult{
+		produced:  make(map[string]bool),
+		resources: index.New(),
+		scopes:    index.NewScopes(config.ClusterScopedKinds),
+	}
+
+	// The report entries and states of the applications, completed once every application has rendered
+	entries := make(map[string]*report.Application)
+	states := make(map[string]*hydrate.State)
+
+	forEachApplication(logOptions.New, config, applications, func(logger *slog.Logger, app application.Application) error {
+		started := time.Now().UTC()
+		entry := &report.Application{Name: app.Metadata.Name, StartedAt: &started}
+
+		state, err := hydrateApplication(logger, helmClient, layout, options, result.scopes, writer, entry, app, config)
+		if err != nil {
+			logger.Error("Failed to hydrate application", "error", err)
+			entry.Status = report.StatusFailed
+
+			failures := failuresOf(app.Metadata.Name, err)
+			for _, f := range failures {
+				entry.Errors = append(entry.Errors, f.String())
+			}
+
+			resultMutex.Lock()
+			result.failures = append(result.failures, failures...)
+			resultMutex.Unlock()
+		}
+
+		entry.DurationSeconds = time.Since(started).Seconds()
+
+		// Track the files produced by this run
+		resultMutex.Lock()
+		entries[app.Metadata.Name] = entry
+		if state != nil {
+			states[app.Metadata.Name] = state
+			result.managed = append(result.managed, app.Metadata.Name)
+			for _, path := range state.Files {
+				result.produced[filepath.FromSlash(path)] = true
+			}
+		}
+		resultMutex.Unlock()
+		return err
+	})
+
+	// Whether another application's CustomResourceDefinitions were known when an application was keyed depends
+	// on timing, so the keys of its resources are only final once every application has rendered
+	for _, app := range applications {
+		entry, ok := entries[app.Metadata.Name]
+		if !ok {
 			continue
 		}
 
-		// Write each manifest to a separate file
-		for _, manifest := range manifests {
-			// Form output file path
-			resourceName := util.SanitizeFileName(manifest.Name)
-
-			// Build directory path based on namespace
-			// Format: appOutputDir/namespace/Kind/name.yaml for namespaced resources
-			// Format: appOutputDir/Kind/name.yaml for cluster-scoped resources
-			var resourceTypeDir string
-			if manifest.Namespace != "" {
-				// Namespaced resource: create namespace/Kind directory structure
-				namespaceDir := util.SanitizeFileName(manifest.Namespace)
-				resourceTypeDir = filepath.Join(appOutputDir, namespaceDir, manifest.Kind)
-			} else {
-				// Cluster-scoped resource: create Kind directory directly
-				resourceTypeDir = filepath.Join(appOutputDir, manifest.Kind)
+		if state, ok := states[app.Metadata.Name]; ok {
+			if normaliseState(result.scopes, state) && entry.Status == report.StatusOK {
+				if err := writer.UpdateState(app.Metadata.Name, *state); err != nil {
+					entry.Status = report.StatusFailed
+					entry.Errors = append(entry.Errors, err.Error())
+					result.failures = append(result.failures, failure{app: app.Metadata.Name, err: err})
+				}
 			}
 
-			if err := os.MkdirAll(resourceTypeDir, 0755); err != nil {
-				fmt.Printf("Error creating resource type directory %s: %v\n", resourceTypeDir, err)
-				os.Exit(1)
+			for _, resource := range state.Resources {
+				if key, err := index.ParseKey(resource); err == nil {
+					result.resources.Add(app.Metadata.Name, key)
+				}
 			}
+		}
+
+		// The report must not depend on timing either, so that it can be compared between runs
+		for i, resource := range entry.Resources {
+			entry.Resources[i].Namespace = result.scopes.Normalise(resource.Key()).Namespace
+		}
+		recorder.Record(entry)
+	}
+
+	sortFailures(result.failures, applications)
+	return result
+}
+
+// normaliseState removes the namespace from the keys of cluster-scoped resources in a state and returns true
+// if any key changed
+func normaliseState(scopes *index.Scopes, state *hydrate.State) bool {
+	changed := false
+	for i, resource := range state.Resources {
+		key, err := index.ParseKey(resource)
+		if err != nil {
+			continue
+		}
+		if normalised := scopes.Normalise(key).String(); normalised != resource {
+			state.Resources[i] = normalised
+			changed = true
+		}
+	}
+	return changed
+}
+
+// sortFailures sorts failures in the order of the applications, regardless of which worker finished first
+func sortFailures(failures []failure, applications []application.Application) {
+	appOrder := make(map[string]int)
+	for i, app := range applications {
+		appOrder[app.Metadata.Name] = i
+	}
+
+	sort.SliceStable(failures, func(i, j int) bool {
+		return appOrder[failures[i].app] < appOrder[failures[j].app]
+	})
+}
+
+// failuresOf splits the error of an application into one failure per failed source
+func failuresOf(appName string, err error) []failure {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+
+	var failures []failure
+	for _, err := range errs {
+		var sourceErr *hydrate.SourceError
+		if errors.As(err, &sourceErr) {
+			failures = append(failures, failure{app: appName, source: sourceErr.Source.String(), err: sourceErr.Err})
+		} else {
+			failures = append(failures, failure{app: appName, err: err})
+		}
+	}
+	return failures
+}
+
+// String describes the failure, including the source it is attributed to
+func (f failure) String() string {
+	if f.source == "" {
+		return f.err.Error()
+	}
+	return fmt.Sprintf("%s: %v", f.source, f.err)
+}
+
+// logFailures logs a summary of every failure of the run
+func logFailures(logger *slog.Logger, failures []failure) {
+	if len(failures) == 0 {
+		return
+	}
+
+	apps := make(map[string]bool)
+	for _, f := range failures {
+		apps[f.app] = true
+	}
+
+	logger.Error("Hydration failed", "failures", len(failures), "applications", len(apps))
+	for _, f := range failures {
+		attrs := []any{"application", f.app}
+		if f.source != "" {
+			attrs = append(attrs, "source", f.source)
+		}
+		logger.Error("Failure", append(attrs, "error", f.err)...)
+	}
+}
+
+// hydrateApplication renders a single application and stages its manifests for the output directory,
+// skipping it when its inputs are unchanged since the previous run. The outcome is described in entry.
+// It returns the application's state, which is nil for an unchanged application whose files were not
+// recorded by the previous run
+func hydrateApplication(logger *slog.Logger, helmClient *helm.Client, layout output.Layout, options hydrate.Options, scopes *index.Scopes, writer output.Writer, entry *report.Application, app application.Application, cfg *config.Configuration) (*hydrate.State, error) {
+	logger.Info("Processing application")
+	helmClient = clusterClient(helmClient, cfg, app)
+
+	// Compare the application's inputs with those of the previous run
+	fingerprint, err := hydrate.Fingerprint(logger, helmClient, app, toolVersion(), outputOptions(cfg, options),
+		[]string{cfg.ChartsDir, cfg.OutputDir})
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := hydrate.ReadState(filepath.Join(cfg.OutputDir, app.Metadata.Name))
+	if err != nil {
+		return nil, err
+	}
 
-			outputFile := filepath.Join(resourceTypeDir, resourceName+".yaml")
+	// Check mode always renders, to compare the actual output
+	if !cfg.Force && !cfg.Check && state.Fingerprint == fingerprint {
+		logger.Info("Application is unchanged, skipping")
 
-			// Write manifest to file
-			if err := os.WriteFile(outputFile, []byte(manifest.Content), 0644); err != nil {
-				fmt.Printf("Error writing manifest %s/%s: %v\n", manifest.Kind, manifest.Name, err)
-				os.Exit(1)
+		entry.Status = report.StatusUnchanged
+		scopes.Add(state.ClusterScopedKinds...)
+		for _, resource := range state.Resources {
+			if key, err := index.ParseKey(resource); err == nil {
+				entry.Resources = append(entry.Resources, report.ResourceFromKey(key))
 			}
 		}
 
-		fmt.Printf("Successfully hydrated application %s with %d manifests\n", app.Metadata.Name, len(manifests))
+		// The files recorded by the previous run are still current
+		if state.Files == nil {
+			return nil, nil
+		}
+		return &state, nil
+	}
+
+	// Render the application
+	result, err := hydrate.HydrateFromApplication(logger, helmClient, options, app)
+	if err != nil {
+		return nil, err
+	}
+	manifests := result.Manifests
+
+	entry.Sources = report.Sources(result)
+	entry.Warnings = append(entry.Warnings, result.Warnings...)
+
+	// Stage the manifests in files according to the layout
+	files, err := output.ApplicationFiles(layout, app.Metadata.Name, manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cluster-scoped custom resources must not be placed in the destination namespace
+	clusterScopedKinds, err := scopes.AddCRDs(manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	state = hydrate.State{Fingerprint: fingerprint, Files: []string{}, Charts: hydrate.ChartVersions(app), ClusterScopedKinds: clusterScopedKinds}
+	for _, file := range files {
+		state.Files = append(state.Files, filepath.ToSlash(file.Path))
+	}
+	for _, file := range files {
+		for _, manifest := range file.Manifests {
+			key := scopes.KeyOf(manifest, app.GetEffectiveNamespace())
+			state.Resources = append(state.Resources, key.String())
+			entry.Resources = append(entry.Resources, report.NewResource(manifest, key, file.Path))
+		}
+	}
+
+	if err := writer.Stage(app.Metadata.Name, files, state); err != nil {
+		return nil, err
+	}
+
+	if len(manifests) > 0 {
+		logger.Info("Hydrated application", "manifests", len(manifests))
+	}
+	entry.Status = report.StatusOK
+	return &state, nil
+}
+
+// reportDuplicates logs every resource rendered by more than one application, records it as a
+// warning of each of those applications and returns true if there are any
+func reportDuplicates(logger *slog.Logger, recorder *report.Recorder, result *runResult) bool {
+	duplicates := result.resources.Duplicates(result.scopes)
+	for _, duplicate := range duplicates {
+		warning := fmt.Sprintf("%s is rendered by multiple applications: %s",
+			duplicate.Key, strings.Join(duplicate.Applications, ", "))
+		logger.Warn("Resource is rendered by multiple applications",
+			"resource", duplicate.Key.String(), "applications", duplicate.Applications)
+
+		for _, appName := range duplicate.Applications {
+			recorder.AddWarning(appName, warning)
+		}
+	}
+	return len(duplicates) > 0
+}
+
+// writeReport writes the run report, if one was requested
+func writeReport(logger *slog.Logger, cfg *config.Configuration, recorder *report.Recorder) {
+	if cfg.ReportFile == "" {
+		return
+	}
+
+	if err := recorder.Write(cfg.ReportFile); err != nil {
+		logger.Error("Failed to write report", "error", err)
+		return
+	}
+	logger.Info("Report written", "file", cfg.ReportFile)
+}
+
+// selectApplications returns the applications matching the configured selection. Names are added to
+// the --app patterns
+func selectApplications(logger *slog.Logger, cfg *config.Configuration, applications []application.Application, names []string) ([]application.Application, error) {
+	selector, err := newSelector(cfg, names)
+	if err != nil {
+		return nil, err
+	}
+	if selector.Empty() {
+		return applications, nil
+	}
+
+	selected, err := selector.Select(applications)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Selected applications", "selected", len(selected), "total", len(applications))
+	return selected, nil
+}
+
+// newSelector creates the selector of the configured selection, adding names to the --app patterns
+func newSelector(cfg *config.Configuration, names []string) (*application.Selector, error) {
+	return application.NewSelector(append(append([]string{}, cfg.Apps...), names...),
+		cfg.Selector, cfg.Project, cfg.DestinationNamespace, cfg.DestinationServer)
+}
+
+// filterChangedApplications returns the applications affected by the configured change set
+func filterChangedApplications(cfg *config.Configuration, applications []application.Application) ([]application.Application, error) {
+	if cfg.ChangedSince != "" && cfg.ChangedFiles != "" {
+		return nil, fmt.Errorf("--changed-since and --changed-files cannot be used together")
+	}
+
+	var changeSet *changes.Set
+	var err error
+	if cfg.ChangedSince != "" {
+		changeSet, err = changes.FromGit(cfg.ChangedSince)
+	} else if cfg.ChangedFiles == "-" {
+		changeSet, err = changes.FromReader(os.Stdin)
+	} else {
+		var file *os.File
+		file, err = os.Open(cfg.ChangedFiles)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open changed files list: %w", err)
+		}
+		defer file.Close()
+		changeSet, err = changes.FromReader(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return changeSet.Filter(cfg.ApplicationsFile, applications)
+}
+
+// checkOutput compares rendered files with the output directory, logging every difference.
+// It returns the exit code: exitOutOfDate if there are differences, 1 on errors and 0 otherwise
+func checkOutput(logger *slog.Logger, cfg *config.Configuration, files []output.File, applicationNames, managed []string, produced map[string]bool) int {
+	// Stale files only count as deleted when a run would actually prune them
+	var stale []string
+	if cfg.Prune == output.PruneOn {
+		var err error
+		stale, err = output.StaleFiles(cfg.OutputDir, applicationNames, managed, produced)
+		if err != nil {
+			logger.Error("Failed to scan output directory", "dir", cfg.OutputDir, "error", err)
+			return 1
+		}
+	}
+
+	changes, err := output.Compare(cfg.OutputDir, files, stale)
+	if err != nil {
+		logger.Error("Failed to compare output directory", "dir", cfg.OutputDir, "error", err)
+		return 1
+	}
+
+	if changes.Empty() {
+		logger.Info("Output directory is up to date", "dir", cfg.OutputDir)
+		return 0
+	}
+
+	for _, path := range changes.Added {
+		logger.Warn("Added", "path", filepath.Join(cfg.OutputDir, path))
+	}
+	for _, path := range changes.Modified {
+		logger.Warn("Modified", "path", filepath.Join(cfg.OutputDir, path))
+	}
+	for _, path := range changes.Deleted {
+		logger.Warn("Deleted", "path", filepath.Join(cfg.OutputDir, path))
+	}
+
+	logger.Error("Output directory is out of date, re-run argocd-hydrate to update it", "dir", cfg.OutputDir,
+		"added", len(changes.Added), "modified", len(changes.Modified), "deleted", len(changes.Deleted))
+	return exitOutOfDate
+}
+
+// outputOptions describes the settings that affect the rendered output, for fingerprinting
+func outputOptions(cfg *config.Configuration, hydration hydrate.Options) []string {
+	options := []string{
+		"layout=" + cfg.Layout,
+		"layoutTemplate=" + cfg.LayoutTemplate,
+	}
+	if cfg.IgnoreDifferences {
+		options = append(options, "ignoreDifferences")
+	}
+	if cfg.Normalise {
+		options = append(options, "normalise")
+		for _, pointer := range cfg.RemoveFields {
+			options = append(options, "removeField="+pointer)
+		}
+	}
+	for _, groupKind := range cfg.ClusterScopedKinds {
+		options = append(options, "clusterScopedKind="+groupKind)
+	}
+	if !hydration.Plugins.Empty() {
+		options = append(options, "plugins="+hydration.Plugins.Digest())
 	}
+	return options
 }
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/application"
+	"github.com/kazysgurskas/argocd-hydrate/internal/config"
+	"github.com/kazysgurskas/argocd-hydrate/internal/helm"
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+	"github.com/kazysgurskas/argocd-hydrate/internal/index"
+	"github.com/kazysgurskas/argocd-hydrate/internal/logging"
+)
+
+// Template output formats
+const (
+	templateFormatYAML = "yaml"
+	templateFormatJSON = "json"
+)
+
+// newTemplateCommand creates the template subcommand, which writes the manifests of applications to stdout
+func newTemplateCommand(cfg *config.Configuration) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "template [application-pattern...]",
+		Short: "Write the hydrated manifests of applications to stdout",
+		Long: `Hydrate the applications whose names match the given glob patterns and the selection flags, or every
+application when there are neither, and write their manifests to stdout as a single multi-document YAML stream
+or a JSON List. Nothing is written to the output directory, and log records go to stderr so the stream can be
+piped, e.g. into kubectl diff -f -.`,
+		Run: runTemplate,
+	}
+
+	cmd.Flags().StringVar(&cfg.TemplateFormat, "format", cfg.TemplateFormat,
+		"Format of the manifests written to stdout: yaml (a multi-document stream) or json (a List)")
+
+	return cmd
+}
+
+// runTemplate is the main function for the template command
+func runTemplate(cmd *cobra.Command, args []string) {
+	config := config.GetConfig()
+	logOptions, logger := setupLogging(config)
+
+	if config.TemplateFormat != templateFormatYAML && config.TemplateFormat != templateFormatJSON {
+		logger.Error(fmt.Sprintf("--format must be %s or %s, got %q", templateFormatYAML, templateFormatJSON, config.TemplateFormat))
+		os.Exit(1)
+	}
+
+	// Collect every manifest before writing, so a failure never leaves a partial stream behind
+	_, rendered, failures := renderSelected(logOptions, logger, config, args)
+	if len(failures) > 0 {
+		logFailures(logger, failures)
+		os.Exit(1)
+	}
+
+	var manifests []hydrate.ManifestInfo
+	for _, r := range rendered {
+		manifests = append(manifests, r.result.Manifests...)
+	}
+
+	if err := writeManifests(os.Stdout, manifests, config.TemplateFormat); err != nil {
+		logger.Error("Failed to write manifests", "error", err)
+		os.Exit(1)
+	}
+}
+
+// renderSelected loads the applications, selects those matching the selection flags and patterns, and
+// renders them in memory. It exits if the applications cannot be loaded or selected
+func renderSelected(logOptions logging.Options, logger *slog.Logger, cfg *config.Configuration, patterns []string) (*helm.Client, []renderedApplication, []failure) {
+	applications, err := application.LoadApplications(cfg.ApplicationsFile)
+	if err != nil {
+		logger.Error("Failed to load applications", "error", err)
+		os.Exit(1)
+	}
+
+	applications, err = selectApplications(logger, cfg, applications, patterns)
+	if err != nil {
+		logger.Error("Failed to select applications", "error", err)
+		os.Exit(1)
+	}
+
+	helmClient, err := newHelmClient(cfg)
+	if err != nil {
+		logger.Error("Failed to configure Helm repositories", "error", err)
+		os.Exit(1)
+	}
+
+	options, err := hydrateOptions(cfg)
+	if err != nil {
+		logger.Error("Invalid manifest processing options", "error", err)
+		os.Exit(1)
+	}
+
+	rendered, failures := renderApplications(logOptions.New, helmClient, options, cfg, applications)
+	return helmClient, rendered, failures
+}
+
+// newScopes returns scopes knowing the configured cluster-scoped kinds and those of the CustomResourceDefinitions
+// of every rendered application, as custom resources may be defined by another application. It exits if a CRD
+// cannot be parsed
+func newScopes(logger *slog.Logger, cfg *config.Configuration, rendered []renderedApplication) *index.Scopes {
+	scopes := index.NewScopes(cfg.ClusterScopedKinds)
+	for _, r := range rendered {
+		if _, err := scopes.AddCRDs(r.result.Manifests); err != nil {
+			logger.Error("Failed to read CustomResourceDefinitions", "application", r.app.Metadata.Name, "error", err)
+			os.Exit(1)
+		}
+	}
+	return scopes
+}
+
+// renderedApplication is an application rendered in memory
+type renderedApplication struct {
+	app    application.Application
+	result *hydrate.Result
+}
+
+// renderApplications renders applications in memory with a pool of workers, without looking at the output
+// directory, and returns them in their original order. Unless --keep-going is set, it stops at the first failure
+func renderApplications(newLogger newLoggerFunc, helmClient *helm.Client, options hydrate.Options, cfg *config.Configuration, applications []application.Application) ([]renderedApplication, []failure) {
+	var mutex sync.Mutex
+	results := make(map[string]*hydrate.Result)
+	var failures []failure
+
+	forEachApplication(newLogger, cfg, applications, func(logger *slog.Logger, app application.Application) error {
+		result, err := hydrate.HydrateFromApplication(logger, clusterClient(helmClient, cfg, app), options, app)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil {
+			logger.Error("Failed to hydrate application", "error", err)
+			failures = append(failures, failuresOf(app.Metadata.Name, err)...)
+			return err
+		}
+		results[app.Metadata.Name] = result
+		return nil
+	})
+
+	var rendered []renderedApplication
+	for _, app := range applications {
+		if result, ok := results[app.Metadata.Name]; ok {
+			rendered = append(rendered, renderedApplication{app: app, result: result})
+		}
+	}
+	sortFailures(failures, applications)
+	return rendered, failures
+}
+
+// writeManifests writes manifests to w as a multi-document YAML stream or as a JSON List
+func writeManifests(w io.Writer, manifests []hydrate.ManifestInfo, format string) error {
+	if format == templateFormatYAML {
+		for _, manifest := range manifests {
+			if _, err := io.WriteString(w, manifest.Content); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	items := []interface{}{}
+	for _, manifest := range manifests {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(manifest.Content), &obj); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", manifest, err)
+		}
+		items = append(items, obj)
+	}
+
+	list := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(list)
+}
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/config"
+	"github.com/kazysgurskas/argocd-hydrate/internal/deprecation"
+	"github.com/kazysgurskas/argocd-hydrate/internal/validate"
+)
+
+// Treatments of resources without a schema
+const (
+	// missingSchemasFail fails the command for every resource without a schema
+	missingSchemasFail = "fail"
+
+	// missingSchemasSkipKinds skips resources whose kind has no schema, but fails the command when there are no
+	// schemas for the Kubernetes version of a cluster at all
+	missingSchemasSkipKinds = "skip-kinds"
+
+	// missingSchemasSkip skips every resource without a schema
+	missingSchemasSkip = "skip"
+)
+
+// newValidateCommand creates the validate subcommand, which validates rendered manifests against Kubernetes schemas
+func newValidateCommand(cfg *config.Configuration) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate [application-pattern...]",
+		Short: "Validate the hydrated manifests against Kubernetes schemas",
+		Long: `Hydrate the selected applications and validate every resource against the JSON schema of its kind, without
+writing to the output directory or accessing the network. Schemas of built-in kinds are read from --schema-dir,
+laid out like https://github.com/yannh/kubernetes-json-schema for the Kubernetes version of each application's
+cluster (e.g. v1.31.1-standalone/deployment-apps-v1.json). Custom resources are validated against the schemas of
+CustomResourceDefinitions found in the rendered output or in --crd-schemas. With --strict, fields that are not
+declared in the schema are errors.
+
+Resources without a schema are treated according to --missing-schemas. With fail, each of them fails the command.
+With skip-kinds, the default, they are skipped with a warning, but the command fails when there is no --schema-dir
+or it holds no schemas for the Kubernetes version of a cluster, as every built-in kind would be skipped. With
+skip, they are skipped with a warning, so that e.g. only custom resources are validated without --schema-dir.
+
+Resources are also checked against a built-in table of deprecated apiVersions, for the Kubernetes version of
+each application's cluster or for a future version given with --target-kube-version. Every resource using a
+deprecated or removed apiVersion is reported with its replacement, application and source. The command fails
+if any resource is invalid or uses a removed apiVersion. With --deprecations-only, only apiVersions are checked,
+which needs no schemas.`,
+		Run: runValidate,
+	}
+
+	cmd.Flags().StringVar(&cfg.ValidateSchemaDir, "schema-dir", cfg.ValidateSchemaDir,
+		"Directory holding Kubernetes JSON schemas in the kubernetes-json-schema layout, e.g. v1.31.1-standalone/deployment-apps-v1.json")
+	cmd.Flags().StringArrayVar(&cfg.ValidateCRDSchemas, "crd-schemas", cfg.ValidateCRDSchemas,
+		"File or directory of CustomResourceDefinitions whose schemas validate custom resources, can be repeated")
+	cmd.Flags().BoolVar(&cfg.ValidateStrict, "strict", cfg.ValidateStrict,
+		"Reject fields that are not declared in the schema")
+	cmd.Flags().StringVar(&cfg.ValidateMissingSchemas, "missing-schemas", cfg.ValidateMissingSchemas,
+		"How to treat resources without a schema: fail, skip-kinds to skip them unless a cluster's Kubernetes version has no schemas at all, or skip")
+	cmd.Flags().BoolVar(&cfg.ValidateDeprecationsOnly, "deprecations-only", cfg.ValidateDeprecationsOnly,
+		"Only check apiVersions against the deprecation table, without validating resources against schemas")
+	cmd.Flags().StringVar(&cfg.ValidateTargetKubeVersion, "target-kube-version", cfg.ValidateTargetKubeVersion,
+		"Kubernetes version to check for deprecated and removed apiVersions, by default the version of each application's cluster")
+
+	markPathFlags(cmd.Flags(), "schema-dir", "crd-schemas")
+
+	return cmd
+}
+
+// runValidate is the main function for the validate command
+func runValidate(cmd *cobra.Command, args []string) {
+	config := config.GetConfig()
+	logOptions, logger := setupLogging(config)
+
+	switch config.ValidateMissingSchemas {
+	case missingSchemasFail, missingSchemasSkipKinds, missingSchemasSkip:
+	default:
+		logger.Error(fmt.Sprintf("--missing-schemas must be %s, %s or %s, got %q",
+			missingSchemasFail, missingSchemasSkipKinds, missingSchemasSkip, config.ValidateMissingSchemas))
+		os.Exit(1)
+	}
+
+	if config.ValidateTargetKubeVersion != "" {
+		if err := deprecation.ValidateVersion(config.ValidateTargetKubeVersion); err != nil {
+			logger.Error("Invalid --target-kube-version", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	validator := validate.NewValidator(config.ValidateSchemaDir, config.ValidateStrict)
+	if err := validator.LoadCRDs(config.ValidateCRDSchemas); err != nil {
+		logger.Error("Failed to load CRD schemas", "error", err)
+		os.Exit(1)
+	}
+	if config.ValidateSchemaDir == "" && !config.ValidateDeprecationsOnly {
+		if config.ValidateMissingSchemas != missingSchemasSkip {
+			logger.Error("No schema directory given, set --schema-dir or --missing-schemas=skip to validate only custom resources")
+			os.Exit(1)
+		}
+		logger.Warn("No schema directory given, only custom resources are validated")
+	}
+
+	helmClient, rendered, failures := renderSelected(logOptions, logger, config, args)
+
+	// Custom resources may be defined by another application
+	for _, r := range rendered {
+		if err := validator.AddCRDs(r.result.Manifests); err != nil {
+			logger.Error("Failed to load CRD schemas", "application", r.app.Metadata.Name, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	scopes := newScopes(logger, config, rendered)
+
+	var valid, invalid, missing, deprecated, removed int
+	missingVersions := make(map[string]bool)
+	for _, r := range rendered {
+		appLogger := logger.With("application", r.app.Metadata.Name)
+		kubeVersion := clusterClient(helmClient, config, r.app).KubeVersion()
+
+		// Without schemas for the cluster's version, every built-in kind would be skipped
+		if config.ValidateSchemaDir != "" && !config.ValidateDeprecationsOnly && !missingVersions[kubeVersion] && !validator.HasSchemas(kubeVersion) {
+			missingVersions[kubeVersion] = true
+			if config.ValidateMissingSchemas == missingSchemasSkip {
+				logger.Warn("No schemas for Kubernetes version, only custom resources are validated",
+					"kubeVersion", kubeVersion, "schemaDir", config.ValidateSchemaDir)
+			} else {
+				logger.Error("No schemas for Kubernetes version, set --missing-schemas=skip to validate only custom resources",
+					"kubeVersion", kubeVersion, "schemaDir", config.ValidateSchemaDir)
+			}
+		}
+		targetVersion := kubeVersion
+		if config.ValidateTargetKubeVersion != "" {
+			targetVersion = config.ValidateTargetKubeVersion
+		}
+
+		for _, manifest := range r.result.Manifests {
+			resourceLogger := appLogger.With("resource", scopes.KeyOf(manifest, r.app.GetEffectiveNamespace()).String())
+			if manifest.Source != nil {
+				resourceLogger = resourceLogger.With("source", manifest.Source.String())
+			}
+
+			// Check the apiVersion against the deprecation table
+			finding, err := deprecation.Check(manifest, targetVersion)
+			if err != nil {
+				resourceLogger.Error("Failed to check apiVersion", "error", err)
+				os.Exit(1)
+			}
+			if finding != nil {
+				attrs := []any{"apiVersion", finding.APIVersion, "kind", finding.Kind, "replacement", finding.Replacement,
+					"deprecatedIn", finding.DeprecatedIn, "removedIn", finding.RemovedIn, "kubeVersion", targetVersion}
+				if finding.Removed {
+					resourceLogger.Error("Resource uses a removed apiVersion", attrs...)
+					removed++
+				} else {
+					resourceLogger.Warn("Resource uses a deprecated apiVersion", attrs...)
+					deprecated++
+				}
+			}
+
+			if config.ValidateDeprecationsOnly {
+				continue
+			}
+
+			result, err := validator.Validate(manifest, kubeVersion)
+			if err != nil {
+				resourceLogger.Error("Failed to validate resource", "error", err)
+				invalid++
+				continue
+			}
+
+			switch {
+			case result.Missing:
+				if config.ValidateMissingSchemas == missingSchemasFail {
+					resourceLogger.Error("No schema for resource", "apiVersion", manifest.APIVersion, "kind", manifest.Kind)
+				} else {
+					resourceLogger.Warn("No schema for resource, skipping", "apiVersion", manifest.APIVersion, "kind", manifest.Kind)
+				}
+				missing++
+			case len(result.Errors) > 0:
+				for _, problem := range result.Errors {
+					resourceLogger.Error("Resource does not match schema", "problem", problem)
+				}
+				invalid++
+			default:
+				valid++
+			}
+		}
+	}
+
+	logger.Info("Validation finished", "valid", valid, "invalid", invalid, "skipped", missing,
+		"deprecated", deprecated, "removed", removed)
+
+	if len(failures) > 0 {
+		logFailures(logger, failures)
+		os.Exit(1)
+	}
+	if invalid > 0 || removed > 0 {
+		os.Exit(1)
+	}
+	if (config.ValidateMissingSchemas == missingSchemasFail && missing > 0) ||
+		(config.ValidateMissingSchemas != missingSchemasSkip && len(missingVersions) > 0) {
+		os.Exit(1)
+	}
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // Configuration holds all application configuration
 type Configuration struct {
 	// ApplicationsFile is the path to the file containing ArgoCD Application CRDs
@@ -13,6 +15,136 @@ type Configuration struct {
 
 	// KubeVersion is the Kubernetes version to use for rendering Helm charts
 	KubeVersion string
+
+	// Parallelism is the number of applications hydrated concurrently
+	Parallelism int
+
+	// Force re-renders every application, even when its inputs are unchanged
+	Force bool
+
+	// ChangedSince limits hydration to applications affected by changes since this git ref
+	ChangedSince string
+
+	// ChangedFiles is a file listing changed paths, one per line, or "-" to read them from stdin
+	ChangedFiles string
+
+	// Prune controls removal of stale files from the output directory: "true", "false" or "dry-run"
+	Prune string
+
+	// Check compares the rendered manifests with the output directory instead of writing them
+	Check bool
+
+	// Layout is the name of the output layout: tree, manifest, kind, flat or template
+	Layout string
+
+	// LayoutTemplate is the Go template for output paths used by the template layout
+	LayoutTemplate string
+
+	// Plugins lists Config Management Plugin definition files, or directories of them, that render plugin sources
+	Plugins []string
+
+	// PluginTimeout is how long each plugin command may run before it is stopped
+	PluginTimeout time.Duration
+
+	// ClusterScopedKinds lists cluster-scoped kinds, qualified with their API group, in addition to the built-in
+	// ones and those of rendered CustomResourceDefinitions
+	ClusterScopedKinds []string
+
+	// FailOnDuplicates fails the run when a resource is rendered by more than one application
+	FailOnDuplicates bool
+
+	// Normalise rewrites rendered manifests into a canonical form
+	Normalise bool
+
+	// RemoveFields lists JSON pointers of volatile fields removed from every manifest when normalising
+	RemoveFields []string
+
+	// IgnoreDifferences strips the fields excluded by each application's spec.ignoreDifferences from rendered manifests
+	IgnoreDifferences bool
+
+	// KeepGoing hydrates all applications even if some fail, writing the output of those that succeeded
+	KeepGoing bool
+
+	// ReportFile is the path of the JSON run report, no report is written when empty
+	ReportFile string
+
+	// Apps holds glob patterns of the application names to hydrate
+	Apps []string
+
+	// Selector is a Kubernetes label selector the labels of hydrated applications must match
+	Selector string
+
+	// Project limits hydration to applications of this project
+	Project string
+
+	// DestinationNamespace limits hydration to applications deploying to this namespace
+	DestinationNamespace string
+
+	// DestinationServer limits hydration to applications deploying to this cluster server URL
+	DestinationServer string
+
+	// LogLevel is the minimum level of logged records: debug, info, warn or error
+	LogLevel string
+
+	// LogFormat is the format of logged records: text or json
+	LogFormat string
+
+	// TemplateFormat is the format the template command writes manifests in: yaml or json
+	TemplateFormat string
+
+	// DiffRef is the git ref the diff command compares with, the output directory is compared with when empty
+	DiffRef string
+
+	// DiffSummaryMarkdown is the file the diff command writes a Markdown report to, "-" for stdout
+	DiffSummaryMarkdown string
+
+	// DiffSummaryMaxDiffSize is the size in bytes each resource diff of the Markdown report is truncated to, 0 for no limit
+	DiffSummaryMaxDiffSize int
+
+	// ValidateSchemaDir is the directory holding the Kubernetes JSON schemas the validate command uses
+	ValidateSchemaDir string
+
+	// ValidateCRDSchemas lists CustomResourceDefinition files or directories whose schemas the validate command uses
+	ValidateCRDSchemas []string
+
+	// ValidateStrict makes the validate command reject fields that are not declared in the schema
+	ValidateStrict bool
+
+	// ValidateMissingSchemas decides how the validate command treats resources without a schema: fail, skip-kinds
+	// to skip them unless there are no schemas for a cluster's Kubernetes version at all, or skip
+	ValidateMissingSchemas string
+
+	// ValidateDeprecationsOnly makes the validate command only check apiVersions against the deprecation table,
+	// without validating resources against schemas
+	ValidateDeprecationsOnly bool
+
+	// ValidateTargetKubeVersion is the Kubernetes version the validate command checks for deprecated and removed
+	// APIs, the version of each application's cluster when empty
+	ValidateTargetKubeVersion string
+
+	// PolicyRulesFile is the path of the file containing the rules of the policy command
+	PolicyRulesFile string
+
+	// PolicyFailOn is the least severity of violations that fail the policy command
+	PolicyFailOn string
+
+	// ImagesFormat is the format the images command writes the image list in: text, json or csv
+	ImagesFormat string
+
+	// ImagePaths lists KIND=JSONPATH locations of images in kinds without built-in support, for the images command
+	ImagePaths []string
+
+	// ConfigFile is the path of the configuration file, searched for from the working directory upward when empty
+	ConfigFile string
+
+	// Repositories holds settings of Helm repositories, matched by URL prefix. Only set from the configuration file
+	Repositories []Repository
+
+	// Mirrors maps repository URL prefixes to the URL prefixes of their mirrors. Only set from the configuration file
+	Mirrors map[string]string
+
+	// Clusters holds the profiles of destination clusters. Only set from the configuration file
+	Clusters []Cluster
 }
 
 // Private configuration instance
@@ -27,6 +159,18 @@ func GetConfig() *Configuration {
 			OutputDir:        "manifests",
 			ChartsDir:        "cache",
 			KubeVersion:      "1.31.1", // Default Kubernetes version
+			Parallelism:      1,
+			Prune:            "false",
+			Layout:           "tree",
+			LogLevel:         "info",
+			LogFormat:        "text",
+			TemplateFormat:   "yaml",
+
+			DiffSummaryMaxDiffSize: 4000,
+			ValidateMissingSchemas: "skip-kinds",
+			PolicyFailOn:           "error",
+			ImagesFormat:           "text",
+			PluginTimeout:          90 * time.Second,
 		}
 	}
 	return instance
@@ -44,5 +188,17 @@ func NewConfig() *Configuration {
 		OutputDir:        "manifests",
 		ChartsDir:        "cache",
 		KubeVersion:      "1.31.1", // Default Kubernetes version
+		Parallelism:      1,
+		Prune:            "false",
+		Layout:           "tree",
+		LogLevel:         "info",
+		LogFormat:        "text",
+		TemplateFormat:   "yaml",
+
+		DiffSummaryMaxDiffSize: 4000,
+		ValidateMissingSchemas: "skip-kinds",
+		PolicyFailOn:           "error",
+		ImagesFormat:           "text",
+		PluginTimeout:          90 * time.Second,
 	}
 }
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the configuration file searched for from the working directory upward
+const FileName = ".argocd-hydrate.yaml"
+
+// EnvPrefix is the prefix of environment variables that set options
+const EnvPrefix = "ARGOCD_HYDRATE_"
+
+// Repository holds settings of the Helm repositories whose URL starts with URL. Credentials are
+// referenced by the names of the environment variables holding them, so they never live in the file
+type Repository struct {
+	URL         string `yaml:"url"`
+	UsernameEnv string `yaml:"usernameEnv,omitempty"`
+	PasswordEnv string `yaml:"passwordEnv,omitempty"`
+}
+
+// Cluster is the profile of a destination cluster, matched against the destination name or server of
+// an application. Charts of matching applications are rendered for the cluster's Kubernetes version and API versions
+type Cluster struct {
+	Name        string   `yaml:"name,omitempty"`
+	Server      string   `yaml:"server,omitempty"`
+	KubeVersion string   `yaml:"kubeVersion,omitempty"`
+	APIVersions []string `yaml:"apiVersions,omitempty"`
+}
+
+// File is a parsed configuration file
+type File struct {
+	// Path is the location of the file
+	Path string `yaml:"-"`
+
+	// Settings holds option values keyed by flag name, with the options of subcommands in nested maps keyed by command name
+	Settings map[string]interface{} `yaml:",inline"`
+
+	// Repositories holds settings of Helm repositories
+	Repositories []Repository `yaml:"repositories,omitempty"`
+
+	// Mirrors maps repository URL prefixes to the URL prefixes of their mirrors
+	Mirrors map[string]string `yaml:"mirrors,omitempty"`
+
+	// Clusters holds the profiles of destination clusters
+	Clusters []Cluster `yaml:"clusters,omitempty"`
+}
+
+// FindFile looks for the configuration file in dir and its parent directories and returns its path,
+// or an empty string if there is none
+func FindFile(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	for {
+		path := filepath.Join(dir, FileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadFile reads and parses the configuration file at path
+func LoadFile(path string) (*File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %s: %w", path, err)
+	}
+
+	file := &File{Path: path}
+	if err := yaml.Unmarshal(content, file); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+
+	for i, repository := range file.Repositories {
+		if repository.URL == "" {
+			return nil, fmt.Errorf("repository %d in configuration file %s has no url", i+1, path)
+		}
+	}
+	for i, cluster := range file.Clusters {
+		if cluster.Name == "" && cluster.Server == "" {
+			return nil, fmt.Errorf("cluster %d in configuration file %s has neither a name nor a server", i+1, path)
+		}
+	}
+
+	return file, nil
+}
@@ -0,0 +1,143 @@
+package deprecation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+)
+
+// API is a deprecated apiVersion of a kind
+type API struct {
+	// APIVersion is the deprecated group/version
+	APIVersion string
+
+	// Kind is the kind served by the deprecated apiVersion
+	Kind string
+
+	// Replacement is the apiVersion to migrate to, empty if the kind was removed without a replacement
+	Replacement string
+
+	// DeprecatedIn is the Kubernetes minor version that deprecated the apiVersion, e.g. 1.19
+	DeprecatedIn string
+
+	// RemovedIn is the Kubernetes minor version that stopped serving the apiVersion, e.g. 1.22
+	RemovedIn string
+}
+
+// apis is the table of deprecated apiVersions of built-in kinds, following the Kubernetes deprecated API migration guide
+var apis = []API{
+	// Removed in 1.16
+	{"extensions/v1beta1", "DaemonSet", "apps/v1", "1.9", "1.16"},
+	{"extensions/v1beta1", "Deployment", "apps/v1", "1.9", "1.16"},
+	{"extensions/v1beta1", "ReplicaSet", "apps/v1", "1.9", "1.16"},
+	{"extensions/v1beta1", "NetworkPolicy", "networking.k8s.io/v1", "1.9", "1.16"},
+	{"extensions/v1beta1", "PodSecurityPolicy", "policy/v1beta1", "1.10", "1.16"},
+	{"apps/v1beta1", "Deployment", "apps/v1", "1.9", "1.16"},
+	{"apps/v1beta1", "StatefulSet", "apps/v1", "1.9", "1.16"},
+	{"apps/v1beta2", "DaemonSet", "apps/v1", "1.9", "1.16"},
+	{"apps/v1beta2", "Deployment", "apps/v1", "1.9", "1.16"},
+	{"apps/v1beta2", "ReplicaSet", "apps/v1", "1.9", "1.16"},
+	{"apps/v1beta2", "StatefulSet", "apps/v1", "1.9", "1.16"},
+
+	// Removed in 1.22
+	{"admissionregistration.k8s.io/v1beta1", "MutatingWebhookConfiguration", "admissionregistration.k8s.io/v1", "1.16", "1.22"},
+	{"admissionregistration.k8s.io/v1beta1", "ValidatingWebhookConfiguration", "admissionregistration.k8s.io/v1", "1.16", "1.22"},
+	{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "apiextensions.k8s.io/v1", "1.16", "1.22"},
+	{"apiregistration.k8s.io/v1beta1", "APIService", "apiregistration.k8s.io/v1", "1.19", "1.22"},
+	{"authentication.k8s.io/v1beta1", "TokenReview", "authentication.k8s.io/v1", "1.19", "1.22"},
+	{"authorization.k8s.io/v1beta1", "LocalSubjectAccessReview", "authorization.k8s.io/v1", "1.19", "1.22"},
+	{"authorization.k8s.io/v1beta1", "SelfSubjectAccessReview", "authorization.k8s.io/v1", "1.19", "1.22"},
+	{"authorization.k8s.io/v1beta1", "SubjectAccessReview", "authorization.k8s.io/v1", "1.19", "1.22"},
+	{"certificates.k8s.io/v1beta1", "CertificateSigningRequest", "certificates.k8s.io/v1", "1.19", "1.22"},
+	{"coordination.k8s.io/v1beta1", "Lease", "coordination.k8s.io/v1", "1.19", "1.22"},
+	{"extensions/v1beta1", "Ingress", "networking.k8s.io/v1", "1.14", "1.22"},
+	{"networking.k8s.io/v1beta1", "Ingress", "networking.k8s.io/v1", "1.19", "1.22"},
+	{"networking.k8s.io/v1beta1", "IngressClass", "networking.k8s.io/v1", "1.19", "1.22"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRole", "rbac.authorization.k8s.io/v1", "1.17", "1.22"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRoleBinding", "rbac.authorization.k8s.io/v1", "1.17", "1.22"},
+	{"rbac.authorization.k8s.io/v1beta1", "Role", "rbac.authorization.k8s.io/v1", "1.17", "1.22"},
+	{"rbac.authorization.k8s.io/v1beta1", "RoleBinding", "rbac.authorization.k8s.io/v1", "1.17", "1.22"},
+	{"scheduling.k8s.io/v1beta1", "PriorityClass", "scheduling.k8s.io/v1", "1.14", "1.22"},
+	{"storage.k8s.io/v1beta1", "CSIDriver", "storage.k8s.io/v1", "1.19", "1.22"},
+	{"storage.k8s.io/v1beta1", "CSINode", "storage.k8s.io/v1", "1.17", "1.22"},
+	{"storage.k8s.io/v1beta1", "StorageClass", "storage.k8s.io/v1", "1.19", "1.22"},
+	{"storage.k8s.io/v1beta1", "VolumeAttachment", "storage.k8s.io/v1", "1.19", "1.22"},
+
+	// Removed in 1.25
+	{"autoscaling/v2beta1", "HorizontalPodAutoscaler", "autoscaling/v2", "1.22", "1.25"},
+	{"batch/v1beta1", "CronJob", "batch/v1", "1.21", "1.25"},
+	{"discovery.k8s.io/v1beta1", "EndpointSlice", "discovery.k8s.io/v1", "1.21", "1.25"},
+	{"events.k8s.io/v1beta1", "Event", "events.k8s.io/v1", "1.19", "1.25"},
+	{"node.k8s.io/v1beta1", "RuntimeClass", "node.k8s.io/v1", "1.20", "1.25"},
+	{"policy/v1beta1", "PodDisruptionBudget", "policy/v1", "1.21", "1.25"},
+	{"policy/v1beta1", "PodSecurityPolicy", "", "1.21", "1.25"},
+
+	// Removed in 1.26
+	{"autoscaling/v2beta2", "HorizontalPodAutoscaler", "autoscaling/v2", "1.23", "1.26"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "FlowSchema", "flowcontrol.apiserver.k8s.io/v1", "1.23", "1.26"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "PriorityLevelConfiguration", "flowcontrol.apiserver.k8s.io/v1", "1.23", "1.26"},
+
+	// Removed in 1.27
+	{"storage.k8s.io/v1beta1", "CSIStorageCapacity", "storage.k8s.io/v1", "1.24", "1.27"},
+
+	// Removed in 1.29
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "FlowSchema", "flowcontrol.apiserver.k8s.io/v1", "1.26", "1.29"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "PriorityLevelConfiguration", "flowcontrol.apiserver.k8s.io/v1", "1.26", "1.29"},
+
+	// Removed in 1.32
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "FlowSchema", "flowcontrol.apiserver.k8s.io/v1", "1.29", "1.32"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "PriorityLevelConfiguration", "flowcontrol.apiserver.k8s.io/v1", "1.29", "1.32"},
+}
+
+// Finding is a manifest using an apiVersion that is deprecated or removed in the target Kubernetes version
+type Finding struct {
+	API
+
+	// Removed is true if the target version no longer serves the apiVersion, otherwise it is only deprecated
+	Removed bool
+}
+
+// Check returns the finding for a manifest whose apiVersion is deprecated or removed in kubeVersion,
+// or nil if the apiVersion is still current
+func Check(manifest hydrate.ManifestInfo, kubeVersion string) (*Finding, error) {
+	target, err := parseMinor(kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, api := range apis {
+		if api.APIVersion != manifest.APIVersion || api.Kind != manifest.Kind {
+			continue
+		}
+
+		deprecatedIn, _ := parseMinor(api.DeprecatedIn)
+		removedIn, _ := parseMinor(api.RemovedIn)
+		if target < deprecatedIn {
+			return nil, nil
+		}
+		return &Finding{API: api, Removed: target >= removedIn}, nil
+	}
+	return nil, nil
+}
+
+// ValidateVersion returns an error if version is not a Kubernetes version Check understands
+func ValidateVersion(version string) error {
+	_, err := parseMinor(version)
+	return err
+}
+
+// parseMinor returns the minor version of a Kubernetes 1.x version, such as 1.31, v1.31.1 or 1.31.0-eks-1
+func parseMinor(version string) (int, error) {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+
+	minor, err := strconv.Atoi(strings.SplitN(parts[1], "-", 2)[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+	return minor, nil
+}
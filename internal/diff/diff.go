@@ -0,0 +1,283 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+	"github.com/kazysgurskas/argocd-hydrate/internal/index"
+)
+
+// Kinds of resource changes
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Application holds the manifests of an application on one side of a diff
+type Application struct {
+	// Name is the name of the application
+	Name string
+
+	// Namespace is the namespace of the application's namespaced resources that do not set one
+	Namespace string
+
+	// Manifests holds the rendered manifests
+	Manifests []hydrate.ManifestInfo
+
+	// Charts lists the Helm charts the manifests were rendered from, nil if unknown
+	Charts []hydrate.ChartVersion
+}
+
+// Resource is the change of a single resource
+type Resource struct {
+	// Key identifies the resource
+	Key index.Key
+
+	// Change is Added, Removed or Changed
+	Change string
+
+	// Diff is the unified diff of the normalised manifests
+	Diff string
+}
+
+// ChartBump is a change of the version of a Helm chart
+type ChartBump struct {
+	// RepoURL is the URL of the chart repository
+	RepoURL string
+
+	// Chart is the name of the chart
+	Chart string
+
+	// From is the version before
+	From string
+
+	// To is the version after
+	To string
+}
+
+// String returns the chart and its versions, e.g. "podinfo 6.0.0 → 6.1.0"
+func (b ChartBump) String() string {
+	return fmt.Sprintf("%s %s → %s", b.Chart, b.From, b.To)
+}
+
+// ApplicationDiff holds the changed resources of an application
+type ApplicationDiff struct {
+	// Name is the name of the application
+	Name string
+
+	// Resources holds the changed resources, ordered by key
+	Resources []Resource
+
+	// Charts holds the charts whose version changed
+	Charts []ChartBump
+}
+
+// Counts returns the number of added, removed and changed resources
+func (d ApplicationDiff) Counts() (added, removed, changed int) {
+	for _, resource := range d.Resources {
+		switch resource.Change {
+		case Added:
+			added++
+		case Removed:
+			removed++
+		case Changed:
+			changed++
+		}
+	}
+	return added, removed, changed
+}
+
+// Compare compares the applications of two hydrations, matching resources by group, kind, namespace and
+// name rather than by file, and ignoring key order and formatting. Applications that exist on one side only
+// have all of their resources added or removed. It returns the applications with changes, ordered by name
+func Compare(before, after []Application, scopes *index.Scopes) ([]ApplicationDiff, error) {
+	beforeByName := make(map[string]Application)
+	afterByName := make(map[string]Application)
+	var names []string
+
+	for _, app := range before {
+		beforeByName[app.Name] = app
+		names = append(names, app.Name)
+	}
+	for _, app := range after {
+		if _, ok := beforeByName[app.Name]; !ok {
+			names = append(names, app.Name)
+		}
+		afterByName[app.Name] = app
+	}
+	sort.Strings(names)
+
+	var diffs []ApplicationDiff
+	for _, name := range names {
+		appDiff, err := compareApplication(name, beforeByName[name], afterByName[name], scopes)
+		if err != nil {
+			return nil, err
+		}
+		if len(appDiff.Resources) > 0 || len(appDiff.Charts) > 0 {
+			diffs = append(diffs, appDiff)
+		}
+	}
+	return diffs, nil
+}
+
+// compareApplication compares the resources of an application before and after
+func compareApplication(name string, before, after Application, scopes *index.Scopes) (ApplicationDiff, error) {
+	appDiff := ApplicationDiff{Name: name, Charts: chartBumps(before.Charts, after.Charts)}
+
+	beforeResources, err := normaliseAll(before, scopes)
+	if err != nil {
+		return appDiff, err
+	}
+	afterResources, err := normaliseAll(after, scopes)
+	if err != nil {
+		return appDiff, err
+	}
+
+	keys := make(map[index.Key]bool)
+	for key := range beforeResources {
+		keys[key] = true
+	}
+	for key := range afterResources {
+		keys[key] = true
+	}
+
+	for key := range keys {
+		oldContent, inBefore := beforeResources[key]
+		newContent, inAfter := afterResources[key]
+
+		var change string
+		switch {
+		case !inBefore:
+			change = Added
+		case !inAfter:
+			change = Removed
+		case oldContent != newContent:
+			change = Changed
+		default:
+			continue
+		}
+
+		// Like git, a side without the resource has no lines and is labelled /dev/null
+		unified, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        lines(oldContent),
+			B:        lines(newContent),
+			FromFile: label("a/"+name+"/"+key.String(), inBefore),
+			ToFile:   label("b/"+name+"/"+key.String(), inAfter),
+			Context:  3,
+		})
+		if err != nil {
+			return appDiff, fmt.Errorf("failed to diff %s: %w", key, err)
+		}
+
+		appDiff.Resources = append(appDiff.Resources, Resource{Key: key, Change: change, Diff: unified})
+	}
+
+	sort.Slice(appDiff.Resources, func(i, j int) bool {
+		return appDiff.Resources[i].Key.String() < appDiff.Resources[j].Key.String()
+	})
+	return appDiff, nil
+}
+
+// chartBumps lists the charts present on both sides whose version changed
+func chartBumps(before, after []hydrate.ChartVersion) []ChartBump {
+	versions := make(map[string]string)
+	for _, chart := range before {
+		versions[chart.RepoURL+" "+chart.Chart] = chart.Version
+	}
+
+	var bumps []ChartBump
+	for _, chart := range after {
+		from, ok := versions[chart.RepoURL+" "+chart.Chart]
+		if ok && from != chart.Version {
+			bumps = append(bumps, ChartBump{RepoURL: chart.RepoURL, Chart: chart.Chart, From: from, To: chart.Version})
+		}
+	}
+	return bumps
+}
+
+// lines splits content into lines for diffing, an empty content having none
+func lines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return difflib.SplitLines(strings.TrimSuffix(content, "\n"))
+}
+
+// label returns the file label of a side of a diff
+func label(name string, exists bool) string {
+	if !exists {
+		return "/dev/null"
+	}
+	return name
+}
+
+// normaliseAll normalises the manifests of an application, keyed by resource. A resource defined more than
+// once is an error, since only one of its manifests could be compared
+func normaliseAll(app Application, scopes *index.Scopes) (map[index.Key]string, error) {
+	resources := make(map[index.Key]string)
+	for _, manifest := range app.Manifests {
+		content, err := Normalise(manifest.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to normalise %s of application %s: %w", manifest, app.Name, err)
+		}
+
+		key := scopes.KeyOf(manifest, app.Namespace)
+		if _, ok := resources[key]; ok {
+			return nil, fmt.Errorf("resource %s is defined more than once in application %s", key, app.Name)
+		}
+		resources[key] = content
+	}
+	return resources, nil
+}
+
+// Normalise re-encodes a YAML manifest with sorted keys and consistent formatting, dropping comments,
+// so that only semantic differences remain
+func Normalise(content string) (string, error) {
+	var obj interface{}
+	if err := yaml.Unmarshal([]byte(content), &obj); err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(obj); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// Write prints the changes of every application as unified diffs, followed by the totals
+func Write(w io.Writer, diffs []ApplicationDiff) {
+	var totalAdded, totalRemoved, totalChanged int
+	for _, appDiff := range diffs {
+		added, removed, changed := appDiff.Counts()
+		totalAdded += added
+		totalRemoved += removed
+		totalChanged += changed
+
+		fmt.Fprintf(w, "=== Application %s: %d added, %d removed, %d changed\n", appDiff.Name, added, removed, changed)
+		for _, bump := range appDiff.Charts {
+			fmt.Fprintf(w, "Chart %s\n", bump)
+		}
+		for _, resource := range appDiff.Resources {
+			fmt.Fprintf(w, "%s %s\n", strings.ToUpper(resource.Change[:1])+resource.Change[1:], resource.Key)
+			fmt.Fprint(w, resource.Diff)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "%d application(s) changed: %d added, %d removed, %d changed\n",
+		len(diffs), totalAdded, totalRemoved, totalChanged)
+}
@@ -0,0 +1,104 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteMarkdown prints the changes as a Markdown report for pull request comments: a table of the changed
+// applications with their resource counts and chart version bumps, followed by a collapsible section per
+// application holding its resource diffs. Every diff is truncated to maxDiffSize bytes, unless it is zero
+func WriteMarkdown(w io.Writer, diffs []ApplicationDiff, maxDiffSize int) {
+	fmt.Fprintf(w, "## Hydrated manifest changes\n\n")
+
+	if len(diffs) == 0 {
+		fmt.Fprintf(w, "No changes to hydrated manifests.\n")
+		return
+	}
+
+	var totalAdded, totalRemoved, totalChanged int
+	for _, appDiff := range diffs {
+		added, removed, changed := appDiff.Counts()
+		totalAdded += added
+		totalRemoved += removed
+		totalChanged += changed
+	}
+	fmt.Fprintf(w, "%d application(s) changed: %d added, %d removed, %d changed resource(s)\n\n",
+		len(diffs), totalAdded, totalRemoved, totalChanged)
+
+	// Summary table
+	fmt.Fprintf(w, "| Application | Added | Removed | Changed | Chart versions |\n")
+	fmt.Fprintf(w, "|---|---:|---:|---:|---|\n")
+	for _, appDiff := range diffs {
+		added, removed, changed := appDiff.Counts()
+
+		var bumps []string
+		for _, bump := range appDiff.Charts {
+			bumps = append(bumps, bump.String())
+		}
+
+		fmt.Fprintf(w, "| %s | %d | %d | %d | %s |\n", tableCell(appDiff.Name), added, removed, changed,
+			tableCell(strings.Join(bumps, ", ")))
+	}
+
+	// Resource diffs, collapsed per application
+	for _, appDiff := range diffs {
+		if len(appDiff.Resources) == 0 {
+			continue
+		}
+
+		added, removed, changed := appDiff.Counts()
+		fmt.Fprintf(w, "\n<details>\n<summary><b>%s</b>: %d added, %d removed, %d changed</summary>\n",
+			htmlEscape(appDiff.Name), added, removed, changed)
+
+		for _, resource := range appDiff.Resources {
+			content := truncate(resource.Diff, maxDiffSize)
+			fence := codeFence(content)
+
+			fmt.Fprintf(w, "\n%s `%s`\n\n", strings.ToUpper(resource.Change[:1])+resource.Change[1:], resource.Key)
+			fmt.Fprintf(w, "%sdiff\n%s%s\n", fence, content, fence)
+		}
+
+		fmt.Fprintf(w, "\n</details>\n")
+	}
+}
+
+// truncate shortens a diff to at most maxSize bytes, cutting at a line boundary and noting how many
+// lines were left out. A maxSize of zero leaves the diff as it is
+func truncate(content string, maxSize int) string {
+	if maxSize <= 0 || len(content) <= maxSize {
+		return content
+	}
+
+	cut := strings.LastIndex(content[:maxSize], "\n") + 1
+	omitted := strings.Count(content[cut:], "\n")
+	if !strings.HasSuffix(content, "\n") {
+		omitted++
+	}
+	return fmt.Sprintf("%s... %d more line(s) truncated\n", content[:cut], omitted)
+}
+
+// codeFence returns a backtick fence longer than any run of backticks in content, so it cannot end the block
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for _, c := range content {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// tableCell escapes text for a Markdown table cell
+func tableCell(text string) string {
+	return strings.ReplaceAll(htmlEscape(text), "|", "\\|")
+}
+
+// htmlEscape escapes the characters Markdown would otherwise interpret as HTML
+func htmlEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
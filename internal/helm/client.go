@@ -2,22 +2,75 @@ package helm
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
-	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/repo"
 
-	"github.com/kazysgurskas/argocd-hydrate/internal/config"
 	"github.com/kazysgurskas/argocd-hydrate/pkg/util"
 )
 
+// Client pulls and renders Helm charts, sharing its chart and repository index cache between concurrent callers
+type Client struct {
+	// chartsDir is the directory for storing downloaded Helm charts
+	chartsDir string
+
+	// kubeVersion is the Kubernetes version to use for rendering Helm charts
+	kubeVersion string
+
+	// apiVersions holds additional API versions available to charts, e.g. those of installed CRDs
+	apiVersions []string
+
+	// options holds the repository settings
+	options Options
+
+	// locks serialises downloads of the same chart or repository index, shared by clients for other clusters
+	locks *keyedMutex
+
+	// indexes records the repository URLs whose index is already up to date in this run, shared by clients for other clusters
+	indexes *sync.Map
+}
+
+// NewClient creates a Helm client that caches charts in chartsDir and renders them for kubeVersion
+func NewClient(chartsDir, kubeVersion string, options Options) *Client {
+	return &Client{
+		chartsDir:   chartsDir,
+		kubeVersion: kubeVersion,
+		options:     options,
+		locks:       &keyedMutex{},
+		indexes:     &sync.Map{},
+	}
+}
+
+// ForCluster returns a client that renders charts for a cluster with the given Kubernetes version and
+// additional API versions, sharing the cache of this client. An empty kubeVersion keeps the current one
+func (c *Client) ForCluster(kubeVersion string, apiVersions []string) *Client {
+	clusterClient := *c
+	if kubeVersion != "" {
+		clusterClient.kubeVersion = kubeVersion
+	}
+	clusterClient.apiVersions = apiVersions
+	return &clusterClient
+}
+
+// KubeVersion returns the Kubernetes version used for rendering Helm charts
+func (c *Client) KubeVersion() string {
+	return c.kubeVersion
+}
+
+// APIVersions returns the additional API versions available to charts
+func (c *Client) APIVersions() []string {
+	return c.apiVersions
+}
+
 // isValidKubeVersion checks if the given string is a valid Kubernetes version
 func isValidKubeVersion(version string) bool {
 	re := regexp.MustCompile(`^(\d+)\.(\d+)(\.(\d+))?(-[a-zA-Z0-9]+)?$`)
@@ -43,11 +96,8 @@ func isOCIURL(url string) bool {
 }
 
 // PullChart pulls a Helm chart from a repository using Helm Go packages
-func PullChart(url, chartName, version string) (string, error) {
-	config := config.GetConfig()
-
-	// Use the configured charts directory instead of hardcoded value
-	chartsDir := config.ChartsDir
+func (c *Client) PullChart(logger *slog.Logger, url, chartName, version string) (string, error) {
+	chartsDir := c.chartsDir
 
 	// Ensure the base charts directory exists
 	if err := os.MkdirAll(chartsDir, 0755); err != nil {
@@ -57,9 +107,13 @@ func PullChart(url, chartName, version string) (string, error) {
 	chartDir := filepath.Join(chartsDir, version)
 	chartPath := filepath.Join(chartDir, chartName)
 
+	// Make sure the same chart is never downloaded concurrently
+	unlock := c.locks.Lock("chart:" + chartPath)
+	defer unlock()
+
 	// Check if chart already exists
 	if _, err := os.Stat(chartPath); err == nil {
-		fmt.Printf("Chart %s (version %s) already exists at %s, skipping download.\n", chartName, version, chartPath)
+		logger.Debug("Chart is already cached, skipping download", "chart", chartName, "version", version, "path", chartPath)
 		return chartPath, nil
 	}
 
@@ -68,6 +122,13 @@ func PullChart(url, chartName, version string) (string, error) {
 		return "", fmt.Errorf("failed to create directory %s: %w", chartDir, err)
 	}
 
+	// Pull from a mirror of the repository if one is configured
+	repositoryURL := url
+	if mirror := c.options.mirror(url); mirror != url {
+		logger.Debug("Using repository mirror", "repository", url, "mirror", mirror)
+		url = mirror
+	}
+
 	// Initialize Helm settings
 	settings := cli.New()
 
@@ -78,8 +139,8 @@ func PullChart(url, chartName, version string) (string, error) {
 	client.Untar = true
 	client.DestDir = chartDir
 
-	// Configure repository options
-	repositoryCache := settings.RepositoryCache
+	// Keep repository indexes alongside the charts so they are cached together
+	repositoryCache := filepath.Join(chartsDir, ".repositories")
 
 	// Create the cache directory if it doesn't exist
 	if err := os.MkdirAll(repositoryCache, 0755); err != nil {
@@ -96,7 +157,7 @@ func PullChart(url, chartName, version string) (string, error) {
 
 		// The chart reference is the full OCI path + chart name
 		chartRef := fmt.Sprintf("%s/%s", ociURL, chartName)
-		fmt.Printf("Pulling chart from OCI repository: %s\n", chartRef)
+		logger.Info("Pulling chart from OCI repository", "ref", chartRef)
 
 		_, err := client.Run(chartRef)
 		if err != nil {
@@ -104,7 +165,7 @@ func PullChart(url, chartName, version string) (string, error) {
 		}
 	} else if strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") {
 		// For HTTP(S) repositories
-		err := downloadHTTPSChart(url, chartName, repositoryCache, settings, client)
+		err := c.downloadHTTPSChart(logger, url, repositoryURL, chartName, repositoryCache, client)
 		if err != nil {
 			return "", err
 		}
@@ -112,73 +173,90 @@ func PullChart(url, chartName, version string) (string, error) {
 		return "", fmt.Errorf("unsupported repository URL format: %s", url)
 	}
 
-	fmt.Printf("Successfully pulled %s (version %s) to %s\n", chartName, version, chartPath)
+	logger.Info("Pulled chart", "chart", chartName, "version", version, "path", chartPath)
 	return chartPath, nil
 }
 
-// downloadHTTPSChart downloads a chart from an HTTPS repository
-func downloadHTTPSChart(url, chartName, repositoryCache string, settings *cli.EnvSettings, client *action.Pull) error {
-	// Generate a unique but consistent repo name based on the URL
-	repoName := fmt.Sprintf("repo-%s", strings.ReplaceAll(url, "/", "-"))
-	repoName = strings.ReplaceAll(repoName, ":", "-")
-	repoName = strings.ReplaceAll(repoName, ".", "-")
-	if len(repoName) > 63 {
-		repoName = repoName[:63]
-	}
-
-	// Create a temporary repository entry
+// downloadHTTPSChart downloads a chart from an HTTPS repository at url, which is a mirror of the repository at
+// repositoryURL or the repository itself
+func (c *Client) downloadHTTPSChart(logger *slog.Logger, url, repositoryURL, chartName, repositoryCache string, client *action.Pull) error {
 	repoEntry := repo.Entry{
-		Name: repoName,
+		Name: repositoryName(url),
 		URL:  url,
 	}
 
 	chartRef := fmt.Sprintf("%s/%s", repoEntry.Name, chartName)
 
-	// Create a unique temporary repository config file just for this operation
-	tempRepoFile := filepath.Join(os.TempDir(), fmt.Sprintf("helm-repo-%s.yaml", repoName))
+	// Keep a repository config file per repository next to its cached index, so it can be reused across charts
+	repoConfigFile := filepath.Join(repositoryCache, fmt.Sprintf("%s.yaml", repoEntry.Name))
+	unlock := c.locks.Lock("config:" + repoConfigFile)
+	if _, err := os.Stat(repoConfigFile); err != nil {
+		repoFile := repo.NewFile()
+		repoFile.Add(&repoEntry)
 
-	// Create a new empty repo file
-	repoFile := repo.NewFile()
-	repoFile.Add(&repoEntry)
-
-	// Save the temporary repository file
-	if err := repoFile.WriteFile(tempRepoFile, 0644); err != nil {
-		return fmt.Errorf("failed to write temporary repository config: %w", err)
+		if err := repoFile.WriteFile(repoConfigFile, 0644); err != nil {
+			unlock()
+			return fmt.Errorf("failed to write repository config: %w", err)
+		}
 	}
-	defer os.Remove(tempRepoFile) // Clean up when we're done
+	unlock()
+
+	// Credentials are only kept in memory, never in the repository config file
+	if credentials, ok := c.options.credentials(url, repositoryURL); ok {
+		repoEntry.Username = credentials.Username
+		repoEntry.Password = credentials.Password
+		client.Username = credentials.Username
+		client.Password = credentials.Password
+	}
+
+	// Set the client to use the repository config and index cache
+	client.Settings.RepositoryConfig = repoConfigFile
+	client.Settings.RepositoryCache = repositoryCache
 
-	// Set the client to use our temporary repo file
-	client.Settings.RepositoryConfig = tempRepoFile
+	// Make sure the repository index is available, downloading it only if needed
+	if err := c.ensureRepositoryIndex(logger, &repoEntry, repositoryCache); err != nil {
+		return err
+	}
 
-	// Initialize chart repository and download index
-	chartRepo, err := repo.NewChartRepository(&repoEntry, getter.All(settings))
+	// Download chart
+	_, err := client.Run(chartRef)
 	if err != nil {
-		return fmt.Errorf("failed to create chart repository: %w", err)
+		return fmt.Errorf("failed to download chart: %w", err)
 	}
 
-	chartRepo.CachePath = repositoryCache
+	return nil
+}
+
+// ChartInfo describes a chart in the cache
+type ChartInfo struct {
+	// Path is the location of the unpacked chart
+	Path string
+
+	// Version is the chart version from Chart.yaml
+	Version string
+
+	// Digest is the sha256 digest of the chart contents
+	Digest string
+}
 
-	// Download the repository index
-	_, err = chartRepo.DownloadIndexFile()
+// LoadChartInfo reads the version of the chart at chartPath and computes the digest of its contents
+func LoadChartInfo(chartPath string) (*ChartInfo, error) {
+	metadata, err := chartutil.LoadChartfile(filepath.Join(chartPath, chartutil.ChartfileName))
 	if err != nil {
-		return fmt.Errorf("failed to download repository index: %w", err)
+		return nil, fmt.Errorf("failed to load chart metadata from %s: %w", chartPath, err)
 	}
 
-	// Download chart
-	_, err = client.Run(chartRef)
+	digest, err := util.HashDirectory(chartPath)
 	if err != nil {
-		return fmt.Errorf("failed to download chart: %w", err)
+		return nil, fmt.Errorf("failed to hash chart %s: %w", chartPath, err)
 	}
 
-	return nil
+	return &ChartInfo{Path: chartPath, Version: metadata.Version, Digest: digest}, nil
 }
 
 // RenderHelmChart renders a Helm chart using the Helm Go library
-func RenderHelmChart(chartPath, releaseName, namespace, version string, valueFiles []string) (string, error) {
-	config := config.GetConfig()
-
-	// Parse Kubernetes version
-	kubeVersion := config.KubeVersion
+func (c *Client) RenderHelmChart(logger *slog.Logger, chartPath, releaseName, namespace, version string, valueFiles []string) (string, error) {
+	kubeVersion := c.kubeVersion
 
 	// Validate Kubernetes version format
 	if !isValidKubeVersion(kubeVersion) {
@@ -225,8 +303,9 @@ func RenderHelmChart(chartPath, releaseName, namespace, version string, valueFil
     Major:   major,
     Minor:   minor,
 	}
+	client.APIVersions = chartutil.VersionSet(c.apiVersions)
 
-	fmt.Printf("Using Kubernetes version %s for rendering chart %s\n", kubeVersion, chartPath)
+	logger.Debug("Using Kubernetes version for rendering chart", "kubeVersion", kubeVersion, "path", chartPath)
 
 	// Create values from files
 	values := make(map[string]interface{})
@@ -244,9 +323,8 @@ func RenderHelmChart(chartPath, releaseName, namespace, version string, valueFil
 	release, err := client.Run(chartLoaded, values)
 	if err != nil {
 		if strings.Contains(err.Error(), "kubeVersion") {
-			fmt.Printf("Kubernetes version error detected. Chart requires: %s\n", chartLoaded.Metadata.KubeVersion)
-			fmt.Printf("We're using Kubernetes version: %s\n", client.KubeVersion.String())
-			fmt.Printf("Try using --kube-version flag to set a higher Kubernetes version\n")
+			logger.Warn("Chart does not support the Kubernetes version, try a higher --kube-version",
+				"required", chartLoaded.Metadata.KubeVersion, "kubeVersion", client.KubeVersion.String())
 		}
 		return "", fmt.Errorf("failed to render chart: %w", err)
 	}
@@ -0,0 +1,149 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// indexTTL is how long a cached repository index is trusted before it is revalidated against the remote
+const indexTTL = 1 * time.Hour
+
+// indexTimeout limits the time a repository index download may take
+const indexTimeout = 2 * time.Minute
+
+// indexHTTPClient downloads repository indexes. Helm's getters do not expose response headers, which the
+// ETag revalidation needs, so indexes are requested directly, with a timeout and proxies from the environment
+var indexHTTPClient = &http.Client{
+	Timeout:   indexTimeout,
+	Transport: http.DefaultTransport,
+}
+
+// repositoryNamePrefixLength is the length the readable part of a repository name is cut to
+const repositoryNamePrefixLength = 50
+
+// repositoryName generates a unique but consistent repository name based on the URL: a readable prefix
+// derived from the URL followed by a short hash of the whole URL, so that URLs sharing a long prefix differ
+func repositoryName(url string) string {
+	name := fmt.Sprintf("repo-%s", strings.ReplaceAll(url, "/", "-"))
+	name = strings.ReplaceAll(name, ":", "-")
+	name = strings.ReplaceAll(name, ".", "-")
+	if len(name) > repositoryNamePrefixLength {
+		name = name[:repositoryNamePrefixLength]
+	}
+
+	sum := sha256.Sum256([]byte(url))
+	return name + "-" + hex.EncodeToString(sum[:6])
+}
+
+// ensureRepositoryIndex makes sure the index for the repository is present in the cache directory,
+// downloading it at most once per run and revalidating the on-disk copy with its ETag once it is older than indexTTL
+func (c *Client) ensureRepositoryIndex(logger *slog.Logger, entry *repo.Entry, cacheDir string) error {
+	unlock := c.locks.Lock("index:" + entry.URL)
+	defer unlock()
+
+	if _, ok := c.indexes.Load(entry.URL); ok {
+		return nil
+	}
+
+	indexFile := filepath.Join(cacheDir, helmpath.CacheIndexFile(entry.Name))
+	etagFile := strings.TrimSuffix(indexFile, ".yaml") + ".etag"
+
+	// Reuse the on-disk index while it is fresh
+	if info, err := os.Stat(indexFile); err == nil && time.Since(info.ModTime()) < indexTTL {
+		logger.Debug("Using cached repository index", "repository", entry.URL)
+		c.indexes.Store(entry.URL, true)
+		return nil
+	}
+
+	indexURL, err := repo.ResolveReferenceURL(entry.URL, "index.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to resolve index URL for repository %s: %w", entry.URL, err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, indexURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create index request for repository %s: %w", entry.URL, err)
+	}
+
+	if entry.Username != "" || entry.Password != "" {
+		req.SetBasicAuth(entry.Username, entry.Password)
+	}
+
+	// Only revalidate when we have both an index and the ETag it was served with
+	if _, err := os.Stat(indexFile); err == nil {
+		if etag, err := os.ReadFile(etagFile); err == nil && len(etag) > 0 {
+			req.Header.Set("If-None-Match", string(etag))
+		}
+	}
+
+	resp, err := indexHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download repository index: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		// Refresh the modification time so the index is trusted for another TTL period
+		now := time.Now()
+		if err := os.Chtimes(indexFile, now, now); err != nil {
+			return fmt.Errorf("failed to refresh cached index %s: %w", indexFile, err)
+		}
+		logger.Debug("Cached repository index is up to date", "repository", entry.URL)
+	case http.StatusOK:
+		logger.Info("Downloading repository index", "repository", entry.URL)
+		if err := writeIndex(indexFile, resp.Body); err != nil {
+			return err
+		}
+		if err := os.WriteFile(etagFile, []byte(resp.Header.Get("ETag")), 0644); err != nil {
+			return fmt.Errorf("failed to write index ETag %s: %w", etagFile, err)
+		}
+	default:
+		return fmt.Errorf("failed to download repository index: %s returned %s", indexURL, resp.Status)
+	}
+
+	c.indexes.Store(entry.URL, true)
+	return nil
+}
+
+// writeIndex stores the downloaded index, replacing any previous copy atomically
+func writeIndex(indexFile string, body io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(indexFile), 0755); err != nil {
+		return fmt.Errorf("failed to create index cache directory: %w", err)
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(indexFile), filepath.Base(indexFile)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary index file: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err := io.Copy(tempFile, body); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("failed to download repository index: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to write repository index: %w", err)
+	}
+
+	// Make sure the index parses before it replaces the cached copy
+	if _, err := repo.LoadIndexFile(tempFile.Name()); err != nil {
+		return fmt.Errorf("invalid repository index: %w", err)
+	}
+
+	if err := os.Rename(tempFile.Name(), indexFile); err != nil {
+		return fmt.Errorf("failed to store repository index %s: %w", indexFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package helm
+
+import "sync"
+
+// keyedMutex provides a separate mutex for every key, so unrelated work can proceed concurrently
+type keyedMutex struct {
+	locks sync.Map
+}
+
+// Lock acquires the mutex for the given key and returns the function that releases it
+func (m *keyedMutex) Lock(key string) func() {
+	value, _ := m.locks.LoadOrStore(key, &sync.Mutex{})
+	mutex := value.(*sync.Mutex)
+	mutex.Lock()
+	return mutex.Unlock
+}
@@ -0,0 +1,65 @@
+package helm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Options holds settings for the Helm repositories charts are pulled from
+type Options struct {
+	// Mirrors maps repository URL prefixes to the URL prefixes of their mirrors
+	Mirrors map[string]string
+
+	// Credentials maps repository URL prefixes to the credentials of those repositories. When a mirror is used,
+	// the credentials of the mirror's URL apply, or else those of the original repository URL
+	Credentials map[string]Credentials
+}
+
+// Credentials holds the basic auth credentials of a repository
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Validate checks that credentials are only configured for repositories they are used for. Charts of OCI
+// registries are pulled with the credentials of helm registry login, so configuring others would be ignored
+func (o Options) Validate() error {
+	for url := range o.Credentials {
+		if isOCIURL(url) {
+			return fmt.Errorf("repository %s is an OCI registry, log in with helm registry login instead of configuring its credentials", url)
+		}
+	}
+	return nil
+}
+
+// mirror returns the URL to pull from instead of url, which is url itself without a matching mirror.
+// The longest matching prefix wins
+func (o Options) mirror(url string) string {
+	prefix := longestPrefix(url, o.Mirrors)
+	if prefix == "" {
+		return url
+	}
+	return o.Mirrors[prefix] + strings.TrimPrefix(url, prefix)
+}
+
+// credentials returns the credentials for fetching from url, matched by the longest URL prefix. If url is a
+// mirror without credentials of its own, those of the original repository at repositoryURL are returned
+func (o Options) credentials(url, repositoryURL string) (Credentials, bool) {
+	for _, candidate := range []string{url, repositoryURL} {
+		if prefix := longestPrefix(candidate, o.Credentials); prefix != "" {
+			return o.Credentials[prefix], true
+		}
+	}
+	return Credentials{}, false
+}
+
+// longestPrefix returns the longest key of entries that url starts with, or an empty string if none does
+func longestPrefix[V any](url string, entries map[string]V) string {
+	var longest string
+	for prefix := range entries {
+		if strings.HasPrefix(url, prefix) && len(prefix) > len(longest) {
+			longest = prefix
+		}
+	}
+	return longest
+}
@@ -0,0 +1,193 @@
+package hydrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/application"
+	"github.com/kazysgurskas/argocd-hydrate/internal/helm"
+	"github.com/kazysgurskas/argocd-hydrate/internal/render"
+	"github.com/kazysgurskas/argocd-hydrate/pkg/util"
+)
+
+// StateSchemaVersion is the version of the state format and of the way fingerprints are computed. Changing
+// it invalidates the fingerprints of every previous run
+const StateSchemaVersion = "2"
+
+// StateFileName is the name of the file storing hydration state inside each application's output directory
+const StateFileName = ".argocd-hydrate.json"
+
+// State is the hydration state stored alongside an application's rendered manifests
+type State struct {
+	// Fingerprint is the hash of every input the application was rendered from
+	Fingerprint string `json:"fingerprint"`
+
+	// Files lists the files produced for the application, relative to the output directory
+	Files []string `json:"files"`
+
+	// Resources lists the keys of the resources rendered for the application
+	Resources []string `json:"resources,omitempty"`
+
+	// Charts lists the Helm charts the application was rendered from
+	Charts []ChartVersion `json:"charts,omitempty"`
+
+	// ClusterScopedKinds lists the kinds of the cluster-scoped CustomResourceDefinitions the application renders,
+	// qualified with their API group
+	ClusterScopedKinds []string `json:"clusterScopedKinds,omitempty"`
+}
+
+// ChartVersion identifies a Helm chart of an application and the version it was rendered from
+type ChartVersion struct {
+	// RepoURL is the URL of the chart repository
+	RepoURL string `json:"repoURL"`
+
+	// Chart is the name of the chart
+	Chart string `json:"chart"`
+
+	// Version is the target revision of the source
+	Version string `json:"version"`
+}
+
+// ChartVersions lists the Helm charts of an application's sources with their target revisions
+func ChartVersions(app application.Application) []ChartVersion {
+	var charts []ChartVersion
+	for _, source := range app.GetSources() {
+		if source.IsHelmChart() {
+			charts = append(charts, ChartVersion{RepoURL: source.RepoURL, Chart: source.Chart, Version: source.TargetRevision})
+		}
+	}
+	return charts
+}
+
+// Fingerprint hashes all inputs of an application: its spec, chart contents, value files,
+// directory contents, the Kubernetes version, the tool version and any other options that affect the output.
+// The directories in excluded, such as the chart cache and the output directory, are not hashed as part of
+// directory and plugin sources
+func Fingerprint(logger *slog.Logger, helmClient *helm.Client, app application.Application, toolVersion string, options []string, excluded []string) (string, error) {
+	h := sha256.New()
+
+	spec, err := yaml.Marshal(app)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal application %s: %w", app.Metadata.Name, err)
+	}
+	writeField(h, "stateSchemaVersion", []byte(StateSchemaVersion))
+	writeField(h, "application", spec)
+	writeField(h, "kubeVersion", []byte(helmClient.KubeVersion()))
+	for _, apiVersion := range helmClient.APIVersions() {
+		writeField(h, "apiVersion", []byte(apiVersion))
+	}
+	writeField(h, "toolVersion", []byte(toolVersion))
+	for _, option := range options {
+		writeField(h, "option", []byte(option))
+	}
+
+	var errs []error
+	for _, source := range app.GetSources() {
+		if source.IsValueSource() {
+			continue
+		}
+
+		if err := hashSource(logger.With("source", source.String()), h, helmClient, source, excluded); err != nil {
+			errs = append(errs, &SourceError{Source: source, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashSource hashes the inputs of a single source: the chart and value files of a Helm source,
+// or the contents of a directory or plugin source. Plugins are also given the checked out commit,
+// so it is hashed too
+func hashSource(logger *slog.Logger, h hash.Hash, helmClient *helm.Client, source *application.Source, excluded []string) error {
+	if source.IsHelmChart() {
+		chartPath, err := helmClient.PullChart(logger, source.RepoURL, source.Chart, source.TargetRevision)
+		if err != nil {
+			return err
+		}
+		if err := hashTree(h, "chart", chartPath, nil); err != nil {
+			return err
+		}
+
+		for _, valueFile := range source.GetValueFiles() {
+			content, err := os.ReadFile(valueFile)
+			if err != nil {
+				return fmt.Errorf("failed to read values file %s: %w", valueFile, err)
+			}
+			writeField(h, "values:"+valueFile, content)
+		}
+	} else if source.IsPlugin() {
+		path := source.Path
+		if path == "" {
+			path = "."
+		}
+		if err := hashTree(h, "plugin", path, excluded); err != nil {
+			return err
+		}
+		writeField(h, "revision", []byte(render.GitRevision(path)))
+	} else if source.IsDirectory() {
+		if err := hashTree(h, "directory", source.Path, excluded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashTree hashes the contents of the directory under root, except for the directories in excluded, into a
+// single field
+func hashTree(h hash.Hash, label, root string, excluded []string) error {
+	digest, err := util.HashDirectory(root, excluded...)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s %s: %w", label, root, err)
+	}
+	writeField(h, label, []byte(digest))
+	return nil
+}
+
+// writeField writes a length-prefixed name and value to the hash so that fields cannot run into each other
+func writeField(h hash.Hash, name string, value []byte) {
+	fmt.Fprintf(h, "%d:%s%d:", len(name), name, len(value))
+	h.Write(value)
+}
+
+// ReadState reads the hydration state from an application's output directory, returning an empty state if there is none
+func ReadState(appOutputDir string) (State, error) {
+	var state State
+
+	content, err := os.ReadFile(filepath.Join(appOutputDir, StateFileName))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read state for %s: %w", appOutputDir, err)
+	}
+
+	if err := json.Unmarshal(content, &state); err != nil {
+		return state, fmt.Errorf("failed to parse state for %s: %w", appOutputDir, err)
+	}
+	return state, nil
+}
+
+// WriteState stores the hydration state in an application's output directory
+func WriteState(appOutputDir string, state State) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state for %s: %w", appOutputDir, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(appOutputDir, StateFileName), append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write state for %s: %w", appOutputDir, err)
+	}
+	return nil
+}
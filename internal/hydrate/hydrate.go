@@ -1,28 +1,94 @@
 package hydrate
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"regexp"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/kazysgurskas/argocd-hydrate/internal/application"
+	"github.com/kazysgurskas/argocd-hydrate/internal/helm"
+	"github.com/kazysgurskas/argocd-hydrate/internal/plugin"
 	"github.com/kazysgurskas/argocd-hydrate/internal/render"
 	"github.com/kazysgurskas/argocd-hydrate/pkg/util"
 )
 
 // ManifestInfo represents a single Kubernetes manifest
 type ManifestInfo struct {
-	Kind      string
-	Name      string
-	Namespace string
-	Content   string
+	APIVersion string
+	Kind       string
+	Name       string
+	Namespace  string
+	Content    string
+
+	// Source is the application source the manifest was rendered from
+	Source *application.Source
+}
+
+// SourceInfo describes how a source of an application was rendered
+type SourceInfo struct {
+	// Source is the source as defined in the application
+	Source *application.Source
+
+	// Chart is the chart a Helm source was rendered from, nil for other sources
+	Chart *helm.ChartInfo
+
+	// ValueFiles holds the value files a Helm source was rendered with
+	ValueFiles []string
+
+	// Plugin is the name of the Config Management Plugin a plugin source was rendered with
+	Plugin string
+}
+
+// Options configures the rendering and processing of manifests
+type Options struct {
+	// Plugins holds the Config Management Plugins that render plugin sources
+	Plugins *plugin.Registry
+
+	// Normaliser normalises the manifests, unless it is nil
+	Normaliser *Normaliser
+
+	// IgnoreDifferences strips the fields the application's spec.ignoreDifferences excludes from comparison
+	IgnoreDifferences bool
+}
+
+// Result is the outcome of hydrating an application
+type Result struct {
+	// Manifests holds the rendered manifests
+	Manifests []ManifestInfo
+
+	// Sources describes every rendered source
+	Sources []SourceInfo
+
+	// Warnings holds problems that did not prevent hydration
+	Warnings []string
 }
 
-// HydrateFromApplication hydrates ArgoCD application into Kubernetes manifests
-func HydrateFromApplication(app application.Application) ([]ManifestInfo, error) {
-	var allManifests []ManifestInfo
+// SourceError is a failure to render a single source of an application
+type SourceError struct {
+	// Source is the source that failed
+	Source *application.Source
+
+	// Err is the underlying error
+	Err error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("source %s: %v", e.Source, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// HydrateFromApplication hydrates ArgoCD application into Kubernetes manifests, logging progress to logger.
+// Every source is rendered even if an earlier one failed, and the failures are returned together as
+// SourceErrors. The manifests are processed according to options
+func HydrateFromApplication(logger *slog.Logger, helmClient *helm.Client, options Options, app application.Application) (*Result, error) {
+	result := &Result{}
 
 	// Extract key information from the Application CRD
 	name := app.Metadata.Name
@@ -30,6 +96,7 @@ func HydrateFromApplication(app application.Application) ([]ManifestInfo, error)
 
 	// Get all sources for the application
 	sources := app.GetSources()
+	var errs []error
 
 	for _, source := range sources {
 		// Skip sources that are just for reference values
@@ -40,40 +107,72 @@ func HydrateFromApplication(app application.Application) ([]ManifestInfo, error)
 		var sourceManifestsStr string
 		var err error
 
+		sourceLogger := logger.With("source", source.String())
+		sourceInfo := SourceInfo{Source: source}
 		if source.IsHelmChart() {
-			sourceManifestsStr, err = render.ProcessHelmChart(source, name, namespace)
+			sourceInfo.ValueFiles = source.GetValueFiles()
+			sourceManifestsStr, sourceInfo.Chart, err = render.ProcessHelmChart(sourceLogger, helmClient, source, name, namespace)
+		} else if source.IsPlugin() {
+			sourceManifestsStr, sourceInfo.Plugin, err = render.ProcessPlugin(sourceLogger, options.Plugins, helmClient, source, app)
 		} else if source.IsDirectory() {
-			sourceManifestsStr, err = render.ProcessDirectory(source)
+			sourceManifestsStr, err = render.ProcessDirectory(sourceLogger, source)
 		} else {
 			// Dump the source for debugging
 			sourceYaml, _ := yaml.Marshal(source)
-			fmt.Printf("Unsupported source type for application %s. Source details:\n%s\n", name, string(sourceYaml))
-			return nil, fmt.Errorf("unsupported source type for application %s", name)
+			sourceLogger.Debug("Unsupported source type", "details", string(sourceYaml))
+			errs = append(errs, &SourceError{Source: source, Err: fmt.Errorf("unsupported source type for application %s", name)})
+			continue
 		}
 
 		if err != nil {
-			return nil, err
+			errs = append(errs, &SourceError{Source: source, Err: err})
+			continue
 		}
+		result.Sources = append(result.Sources, sourceInfo)
 
 		if sourceManifestsStr != "" {
 			// Parse the manifests into individual documents
-			manifests, err := parseManifests(sourceManifestsStr)
+			manifests, err := ParseManifests(sourceManifestsStr)
 			if err != nil {
-				return nil, fmt.Errorf("error parsing manifests for application %s: %w", name, err)
+				errs = append(errs, &SourceError{Source: source, Err: fmt.Errorf("error parsing manifests for application %s: %w", name, err)})
+				continue
+			}
+			for i := range manifests {
+				manifests[i].Source = source
 			}
-			allManifests = append(allManifests, manifests...)
+			if options.IgnoreDifferences {
+				manifests, err = StripIgnoredDifferences(manifests, app)
+				if err != nil {
+					errs = append(errs, &SourceError{Source: source, Err: err})
+					continue
+				}
+			}
+			if options.Normaliser != nil {
+				manifests, err = options.Normaliser.NormaliseAll(manifests)
+				if err != nil {
+					errs = append(errs, &SourceError{Source: source, Err: fmt.Errorf("error normalising manifests for application %s: %w", name, err)})
+					continue
+				}
+			}
+			result.Manifests = append(result.Manifests, manifests...)
 		}
 	}
 
-	if len(allManifests) == 0 {
-		fmt.Printf("WARNING: No manifests generated for application %s\n", name)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
 	}
 
-	return allManifests, nil
+	if len(result.Manifests) == 0 {
+		warning := fmt.Sprintf("No manifests generated for application %s", name)
+		logger.Warn(warning)
+		result.Warnings = append(result.Warnings, warning)
+	}
+
+	return result, nil
 }
 
-// parseManifests splits a multi-document YAML string into individual ManifestInfo objects
-func parseManifests(yamlContent string) ([]ManifestInfo, error) {
+// ParseManifests splits a multi-document YAML string into individual ManifestInfo objects
+func ParseManifests(yamlContent string) ([]ManifestInfo, error) {
 	re := regexp.MustCompile(`(?m)^---`)
 	docs := re.Split(yamlContent, -1)
 	var manifests []ManifestInfo
@@ -97,6 +196,8 @@ func parseManifests(yamlContent string) ([]ManifestInfo, error) {
 			continue
 		}
 
+		apiVersion, _ := util.GetNestedString(obj, "apiVersion")
+
 		// Get the name from metadata
 		metadata, ok := obj["metadata"].(map[string]interface{})
 		if !ok {
@@ -141,16 +242,53 @@ func parseManifests(yamlContent string) ([]ManifestInfo, error) {
 		}
 
 		manifests = append(manifests, ManifestInfo{
-			Kind:      kind,
-			Name:      name,
-			Namespace: namespace,
-			Content:   content,
+			APIVersion: apiVersion,
+			Kind:       kind,
+			Name:       name,
+			Namespace:  namespace,
+			Content:    content,
 		})
 	}
 
 	return manifests, nil
 }
 
+// Group returns the API group of the manifest, which is empty for the core group
+func (m ManifestInfo) Group() string {
+	group, _ := m.splitAPIVersion()
+	return group
+}
+
+// Version returns the API version of the manifest without its group
+func (m ManifestInfo) Version() string {
+	_, version := m.splitAPIVersion()
+	return version
+}
+
+// GroupKind returns the Kind qualified with the API group, e.g. Deployment.apps, or just the Kind for the core group
+func (m ManifestInfo) GroupKind() string {
+	if group := m.Group(); group != "" {
+		return m.Kind + "." + group
+	}
+	return m.Kind
+}
+
+// String identifies the manifest by its group, Kind, namespace and name
+func (m ManifestInfo) String() string {
+	if m.Namespace != "" {
+		return fmt.Sprintf("%s %s/%s", m.GroupKind(), m.Namespace, m.Name)
+	}
+	return fmt.Sprintf("%s %s", m.GroupKind(), m.Name)
+}
+
+// splitAPIVersion splits the apiVersion of the manifest into its group and version
+func (m ManifestInfo) splitAPIVersion() (string, string) {
+	if i := strings.LastIndex(m.APIVersion, "/"); i >= 0 {
+		return m.APIVersion[:i], m.APIVersion[i+1:]
+	}
+	return "", m.APIVersion
+}
+
 // obfuscateSecretData replaces all values in the data and stringData fields of a Secret with obfuscated values
 func obfuscateSecretData(obj map[string]interface{}) map[string]interface{} {
 	// Obfuscate data field if it exists
@@ -0,0 +1,275 @@
+package hydrate
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/application"
+)
+
+// StripIgnoredDifferences removes the fields an application's spec.ignoreDifferences excludes from comparison with
+// the cluster, so that they do not show up as changes. Like Argo CD, JSON pointers that do not exist are skipped and
+// the paths of every jq path expression are deleted as with del(). Managed fields managers only exist in the
+// cluster and are ignored
+func StripIgnoredDifferences(manifests []ManifestInfo, app application.Application) ([]ManifestInfo, error) {
+	if len(app.Spec.IgnoreDifferences) == 0 {
+		return manifests, nil
+	}
+
+	stripped := make([]ManifestInfo, 0, len(manifests))
+	for _, manifest := range manifests {
+		manifest, err := stripManifest(manifest, app)
+		if err != nil {
+			return nil, err
+		}
+		stripped = append(stripped, manifest)
+	}
+	return stripped, nil
+}
+
+// stripManifest removes the ignored fields of every matching rule from a manifest. The fields are removed from
+// its YAML nodes, so the order of the remaining keys and their comments are kept. Manifests no rule matches are
+// returned unchanged
+func stripManifest(manifest ManifestInfo, app application.Application) (ManifestInfo, error) {
+	namespace := manifest.Namespace
+	if namespace == "" {
+		namespace = app.GetEffectiveNamespace()
+	}
+
+	var document *yaml.Node
+	for _, rule := range app.Spec.IgnoreDifferences {
+		if !ignoreRuleMatches(rule, manifest, namespace) {
+			continue
+		}
+
+		if document == nil {
+			document = &yaml.Node{}
+			if err := yaml.Unmarshal([]byte(manifest.Content), document); err != nil {
+				return manifest, fmt.Errorf("failed to parse %s: %w", manifest, err)
+			}
+			if len(document.Content) == 0 {
+				return manifest, nil
+			}
+		}
+		root := document.Content[0]
+
+		for _, pointer := range rule.JSONPointers {
+			tokens, err := parsePointer(pointer)
+			if err != nil {
+				return manifest, fmt.Errorf("invalid ignoreDifferences of application %s: %w", app.Metadata.Name, err)
+			}
+			removeNode(root, tokens)
+		}
+
+		for _, expression := range rule.JQPathExpressions {
+			if err := deletePaths(root, expression); err != nil {
+				return manifest, fmt.Errorf("invalid ignoreDifferences of application %s: %w", app.Metadata.Name, err)
+			}
+		}
+	}
+	if document == nil {
+		return manifest, nil
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return manifest, fmt.Errorf("failed to encode %s: %w", manifest, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to encode %s: %w", manifest, err)
+	}
+
+	manifest.Content = "---\n" + buffer.String()
+	return manifest, nil
+}
+
+// ignoreRuleMatches returns true if an ignoreDifferences rule applies to a manifest. Group and kind may be
+// glob patterns, name and namespace match any resource when empty
+func ignoreRuleMatches(rule application.ResourceIgnoreDifferences, manifest ManifestInfo, namespace string) bool {
+	if matched, _ := path.Match(rule.Group, manifest.Group()); !matched {
+		return false
+	}
+	if matched, _ := path.Match(rule.Kind, manifest.Kind); !matched {
+		return false
+	}
+	if rule.Name != "" && rule.Name != manifest.Name {
+		return false
+	}
+	if rule.Namespace != "" && rule.Namespace != namespace {
+		return false
+	}
+	return true
+}
+
+// removeNode removes the field at the path of tokens from a YAML node, if it exists. Like removeField, only
+// fields of mappings are removed
+func removeNode(node *yaml.Node, tokens []string) {
+	last := len(tokens) - 1
+	for _, token := range tokens[:last] {
+		node = childNode(node, token)
+		if node == nil {
+			return
+		}
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == tokens[last] {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// childNode returns the value of a mapping's field or a sequence's item a path token refers to, or nil if there
+// is none
+func childNode(node *yaml.Node, token string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == token {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		index, err := strconv.Atoi(token)
+		if err == nil && index >= 0 && index < len(node.Content) {
+			return node.Content[index]
+		}
+	}
+	return nil
+}
+
+// deletePaths deletes the paths a jq path expression selects from a YAML node, as del() would. The paths are
+// found with path() on the decoded node and deleted from the node itself, the last ones first so that removing
+// items of a sequence does not shift the indices of the other paths
+func deletePaths(root *yaml.Node, expression string) error {
+	query, err := gojq.Parse(fmt.Sprintf("path(%s)", expression))
+	if err != nil {
+		return fmt.Errorf("failed to parse jq path expression %q: %w", expression, err)
+	}
+
+	var obj interface{}
+	if err := root.Decode(&obj); err != nil {
+		return fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	var paths [][]interface{}
+	iter := query.Run(obj)
+	for {
+		result, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, isErr := result.(error); isErr {
+			return fmt.Errorf("failed to evaluate jq path expression %q: %w", expression, err)
+		}
+		jqPath, ok := result.([]interface{})
+		if !ok || len(jqPath) == 0 {
+			continue
+		}
+		paths = append(paths, jqPath)
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		return comparePaths(paths[i], paths[j]) > 0
+	})
+	for _, jqPath := range paths {
+		if err := deleteNodePath(root, jqPath); err != nil {
+			return fmt.Errorf("failed to delete the paths of jq path expression %q: %w", expression, err)
+		}
+	}
+	return nil
+}
+
+// deleteNodePath deletes the field or sequence item at a path returned by jq's path() from a YAML node, if it exists
+func deleteNodePath(node *yaml.Node, jqPath []interface{}) error {
+	tokens := make([]string, len(jqPath))
+	for i, component := range jqPath {
+		switch typed := component.(type) {
+		case string:
+			tokens[i] = typed
+		case int:
+			tokens[i] = strconv.Itoa(typed)
+		case float64:
+			tokens[i] = strconv.Itoa(int(typed))
+		default:
+			return fmt.Errorf("unsupported path component %v", component)
+		}
+	}
+
+	last := len(tokens) - 1
+	parent := node
+	for _, token := range tokens[:last] {
+		parent = childNode(parent, token)
+		if parent == nil {
+			return nil
+		}
+	}
+
+	if parent.Kind == yaml.SequenceNode {
+		index, err := strconv.Atoi(tokens[last])
+		if err == nil && index >= 0 && index < len(parent.Content) {
+			parent.Content = append(parent.Content[:index], parent.Content[index+1:]...)
+		}
+		return nil
+	}
+	removeNode(parent, tokens[last:])
+	return nil
+}
+
+// comparePaths orders two jq paths component by component, with numbers before strings and shorter paths before
+// the paths they are a prefix of
+func comparePaths(a, b []interface{}) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareComponents(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+// compareComponents orders two components of jq paths
+func compareComponents(a, b interface{}) int {
+	aString, aIsString := a.(string)
+	bString, bIsString := b.(string)
+	switch {
+	case aIsString && bIsString:
+		return strings.Compare(aString, bString)
+	case aIsString:
+		return 1
+	case bIsString:
+		return -1
+	}
+
+	aNumber, bNumber := toFloat(a), toFloat(b)
+	switch {
+	case aNumber < bNumber:
+		return -1
+	case aNumber > bNumber:
+		return 1
+	}
+	return 0
+}
+
+// toFloat returns the value of a numeric jq path component
+func toFloat(value interface{}) float64 {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed)
+	case float64:
+		return typed
+	}
+	return 0
+}
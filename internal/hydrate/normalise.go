@@ -0,0 +1,223 @@
+package hydrate
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rootKeyOrder lists the keys that come first in a normalised manifest, the rest following alphabetically
+var rootKeyOrder = []string{"apiVersion", "kind", "metadata", "spec"}
+
+// metadataKeyOrder lists the keys that come first in normalised metadata, the rest following alphabetically
+var metadataKeyOrder = []string{"name", "namespace"}
+
+// meaningfulEmpty lists the fields whose empty value means something different from their absence,
+// e.g. an empty podSelector selects every pod, so normalisation keeps them
+var meaningfulEmpty = map[string]bool{
+	"emptyDir":          true,
+	"namespaceSelector": true,
+	"podSelector":       true,
+	"selector":          true,
+	"spec":              true,
+	"status":            true,
+}
+
+// Normaliser rewrites rendered manifests into a canonical form, so that changes in the ordering and formatting
+// of chart output do not show up in the output directory
+type Normaliser struct {
+	// removeFields holds the parsed JSON pointers of the fields removed from every manifest
+	removeFields [][]string
+}
+
+// NewNormaliser creates a normaliser that also removes the fields at the given JSON pointers (RFC 6901) from
+// every manifest that has them, e.g. /metadata/labels/helm.sh~1chart
+func NewNormaliser(removeFields []string) (*Normaliser, error) {
+	normaliser := &Normaliser{}
+	for _, pointer := range removeFields {
+		tokens, err := parsePointer(pointer)
+		if err != nil {
+			return nil, err
+		}
+		normaliser.removeFields = append(normaliser.removeFields, tokens)
+	}
+	return normaliser, nil
+}
+
+// Normalise rewrites a manifest: keys are ordered canonically, null and empty fields and the configured
+// volatile fields are removed, comments such as Helm's "# Source:" are stripped, and the document is
+// re-encoded with consistent indentation and quoting
+func (n *Normaliser) Normalise(manifest ManifestInfo) (ManifestInfo, error) {
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal([]byte(manifest.Content), &obj); err != nil {
+		return manifest, fmt.Errorf("failed to parse %s: %w", manifest, err)
+	}
+
+	for _, tokens := range n.removeFields {
+		removeField(obj, tokens)
+	}
+	pruneEmpty(obj)
+
+	// Maps are encoded with sorted keys, only the well-known keys need moving to the front
+	var node yaml.Node
+	if err := node.Encode(obj); err != nil {
+		return manifest, fmt.Errorf("failed to encode %s: %w", manifest, err)
+	}
+	orderKeys(&node, rootKeyOrder)
+	if metadata := mappingValue(&node, "metadata"); metadata != nil {
+		orderKeys(metadata, metadataKeyOrder)
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return manifest, fmt.Errorf("failed to encode %s: %w", manifest, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to encode %s: %w", manifest, err)
+	}
+
+	manifest.Content = "---\n" + buffer.String()
+	return manifest, nil
+}
+
+// NormaliseAll normalises every manifest
+func (n *Normaliser) NormaliseAll(manifests []ManifestInfo) ([]ManifestInfo, error) {
+	normalised := make([]ManifestInfo, 0, len(manifests))
+	for _, manifest := range manifests {
+		manifest, err := n.Normalise(manifest)
+		if err != nil {
+			return nil, err
+		}
+		normalised = append(normalised, manifest)
+	}
+	return normalised, nil
+}
+
+// parsePointer splits a JSON pointer into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q, must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// removeField removes the field at the path of tokens from value, if it exists
+func removeField(value interface{}, tokens []string) {
+	last := len(tokens) - 1
+	for _, token := range tokens[:last] {
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			value = typed[token]
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(typed) {
+				return
+			}
+			value = typed[index]
+		default:
+			return
+		}
+	}
+
+	// Only fields of maps are removed, removing list items would shift the indices of the others
+	if fields, ok := value.(map[string]interface{}); ok {
+		delete(fields, tokens[last])
+	}
+}
+
+// pruneEmpty removes null fields, and empty maps and lists unless their field gives them a meaning, from a map
+// and the maps nested in it. Items of lists are kept, as e.g. an empty NetworkPolicy rule allows all traffic
+func pruneEmpty(fields map[string]interface{}) {
+	for key, value := range fields {
+		pruneNested(value)
+
+		if value == nil || (isEmpty(value) && !meaningfulEmpty[key]) {
+			delete(fields, key)
+		}
+	}
+}
+
+// pruneNested prunes the maps within a value
+func pruneNested(value interface{}) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		pruneEmpty(typed)
+	case []interface{}:
+		for _, item := range typed {
+			pruneNested(item)
+		}
+	}
+}
+
+// isEmpty returns true for empty maps and lists
+func isEmpty(value interface{}) bool {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return len(typed) == 0
+	case []interface{}:
+		return len(typed) == 0
+	}
+	return false
+}
+
+// orderKeys moves the given keys of a mapping node to the front, in order, keeping the order of the others
+func orderKeys(node *yaml.Node, first []string) {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	rank := make(map[string]int, len(first))
+	for i, key := range first {
+		rank[key] = i
+	}
+
+	// Sort key/value pairs, keys not listed keep their relative order after the listed ones
+	pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		rankI, listedI := rank[pairs[i][0].Value]
+		rankJ, listedJ := rank[pairs[j][0].Value]
+		if listedI && listedJ {
+			return rankI < rankJ
+		}
+		return listedI && !listedJ
+	})
+
+	node.Content = node.Content[:0]
+	for _, pair := range pairs {
+		node.Content = append(node.Content, pair[0], pair[1])
+	}
+}
+
+// mappingValue returns the value of a key of a mapping node, or nil if there is none
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package images
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+)
+
+// podSpecPaths lists where built-in kinds hold their pod spec, keyed by Kind qualified with its API group
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"PodTemplate":           {"template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Deployment.apps":       {"spec", "template", "spec"},
+	"StatefulSet.apps":      {"spec", "template", "spec"},
+	"DaemonSet.apps":        {"spec", "template", "spec"},
+	"ReplicaSet.apps":       {"spec", "template", "spec"},
+	"Job.batch":             {"spec", "template", "spec"},
+	"CronJob.batch":         {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// containerFields lists the fields of a pod spec holding containers
+var containerFields = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// Extractor finds the container images of manifests
+type Extractor struct {
+	// paths holds the JSONPaths of images configured for kinds, keyed by Kind or Kind qualified with its API group
+	paths map[string][]*jsonpath.JSONPath
+}
+
+// NewExtractor creates an extractor finding images in the pod specs of built-in kinds and at configured JSONPaths.
+// Each path has the form KIND=JSONPATH, where KIND is a kind optionally qualified with its API group, e.g.
+// Rollout.argoproj.io={.spec.template.spec.containers[*].image}. Configured paths replace the built-in ones
+func NewExtractor(paths []string) (*Extractor, error) {
+	extractor := &Extractor{paths: make(map[string][]*jsonpath.JSONPath)}
+
+	for _, path := range paths {
+		kind, expression, ok := strings.Cut(path, "=")
+		if !ok || kind == "" || expression == "" {
+			return nil, fmt.Errorf("invalid image path %q, expected KIND=JSONPATH", path)
+		}
+
+		// Braces are optional around a single expression
+		if !strings.Contains(expression, "{") {
+			expression = "{" + expression + "}"
+		}
+
+		parser := jsonpath.New(path).AllowMissingKeys(true)
+		if err := parser.Parse(expression); err != nil {
+			return nil, fmt.Errorf("invalid image path %q: %w", path, err)
+		}
+		extractor.paths[kind] = append(extractor.paths[kind], parser)
+	}
+
+	return extractor, nil
+}
+
+// Extract returns the distinct images of a manifest, in the order they appear
+func (e *Extractor) Extract(manifest hydrate.ManifestInfo) ([]string, error) {
+	paths := e.paths[manifest.GroupKind()]
+	if paths == nil {
+		paths = e.paths[manifest.Kind]
+	}
+	podSpecPath, builtIn := podSpecPaths[manifest.GroupKind()]
+	if paths == nil && !builtIn {
+		return nil, nil
+	}
+
+	var object map[string]interface{}
+	if err := yaml.Unmarshal([]byte(manifest.Content), &object); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", manifest, err)
+	}
+
+	var found []string
+	if paths != nil {
+		for _, path := range paths {
+			results, err := path.FindResults(object)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate image path of %s: %w", manifest, err)
+			}
+			for _, values := range results {
+				for _, value := range values {
+					if image, ok := value.Interface().(string); ok {
+						found = append(found, image)
+					}
+				}
+			}
+		}
+	} else {
+		found = podSpecImages(object, podSpecPath)
+	}
+
+	// Images are often repeated between containers of the same resource
+	var images []string
+	seen := make(map[string]bool)
+	for _, image := range found {
+		image = strings.TrimSpace(image)
+		if image != "" && !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+// podSpecImages returns the images of the containers of the pod spec at path in object
+func podSpecImages(object map[string]interface{}, path []string) []string {
+	spec := object
+	for _, field := range path {
+		nested, ok := spec[field].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		spec = nested
+	}
+
+	var images []string
+	for _, field := range containerFields {
+		containers, _ := spec[field].([]interface{})
+		for _, container := range containers {
+			if fields, ok := container.(map[string]interface{}); ok {
+				if image, ok := fields["image"].(string); ok {
+					images = append(images, image)
+				}
+			}
+		}
+	}
+	return images
+}
+
+// Usage is a resource using an image
+type Usage struct {
+	// Application is the name of the application rendering the resource
+	Application string `json:"application"`
+
+	// Resource is the key of the resource, formatted as group/Kind/namespace/name
+	Resource string `json:"resource"`
+}
+
+// Image is an image with the applications and resources using it
+type Image struct {
+	// Image is the image reference as written in the manifests
+	Image string `json:"image"`
+
+	// Applications lists the applications using the image, sorted by name
+	Applications []string `json:"applications"`
+
+	// Resources lists the resources using the image, in the order they were added
+	Resources []Usage `json:"resources"`
+}
+
+// Inventory collects the images of resources, de-duplicated by image reference
+type Inventory struct {
+	images map[string]*Image
+}
+
+// NewInventory creates an empty inventory
+func NewInventory() *Inventory {
+	return &Inventory{images: make(map[string]*Image)}
+}
+
+// Add records that a resource of an application uses an image
+func (i *Inventory) Add(image, application, resource string) {
+	entry, ok := i.images[image]
+	if !ok {
+		entry = &Image{Image: image}
+		i.images[image] = entry
+	}
+
+	entry.Resources = append(entry.Resources, Usage{Application: application, Resource: resource})
+	for _, name := range entry.Applications {
+		if name == application {
+			return
+		}
+	}
+	entry.Applications = append(entry.Applications, application)
+	sort.Strings(entry.Applications)
+}
+
+// Images returns the collected images, sorted by reference
+func (i *Inventory) Images() []Image {
+	images := make([]Image, 0, len(i.images))
+	for _, image := range i.images {
+		images = append(images, *image)
+	}
+	sort.Slice(images, func(a, b int) bool {
+		return images[a].Image < images[b].Image
+	})
+	return images
+}
@@ -0,0 +1,56 @@
+package images
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Output formats of an image list
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Write writes an image list to w in the given format: text lists every image followed by the resources
+// using it, json is an array of images and csv has a row per image and resource
+func Write(w io.Writer, images []Image, format string) error {
+	switch format {
+	case FormatText:
+		for _, image := range images {
+			if _, err := fmt.Fprintln(w, image.Image); err != nil {
+				return err
+			}
+			for _, usage := range image.Resources {
+				if _, err := fmt.Fprintf(w, "  %s: %s\n", usage.Application, usage.Resource); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(images)
+
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"image", "application", "resource"}); err != nil {
+			return err
+		}
+		for _, image := range images {
+			for _, usage := range image.Resources {
+				if err := writer.Write([]string{image.Image, usage.Application, usage.Resource}); err != nil {
+					return err
+				}
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	return fmt.Errorf("unknown format %q, must be %s, %s or %s", format, FormatText, FormatJSON, FormatCSV)
+}
@@ -0,0 +1,108 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Key identifies a resource in the cluster
+type Key struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// GroupKind returns the Kind qualified with the API group, e.g. Deployment.apps, or just the Kind for the core group
+func (k Key) GroupKind() string {
+	if k.Group != "" {
+		return k.Kind + "." + k.Group
+	}
+	return k.Kind
+}
+
+// String formats the key as group/Kind/namespace/name
+func (k Key) String() string {
+	return strings.Join([]string{k.Group, k.Kind, k.Namespace, k.Name}, "/")
+}
+
+// ParseKey parses a key formatted by Key.String
+func ParseKey(s string) (Key, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 4 {
+		return Key{}, fmt.Errorf("invalid resource key %q", s)
+	}
+	return Key{Group: parts[0], Kind: parts[1], Namespace: parts[2], Name: parts[3]}, nil
+}
+
+// Duplicate is a resource rendered by more than one application
+type Duplicate struct {
+	Key          Key
+	Applications []string
+}
+
+// Index maps resources to the applications rendering them
+type Index struct {
+	// mutex guards owners, as applications are added concurrently
+	mutex sync.Mutex
+
+	// owners holds the applications rendering each resource
+	owners map[Key][]string
+}
+
+// New creates an empty resource index
+func New() *Index {
+	return &Index{owners: make(map[Key][]string)}
+}
+
+// Add records that an application renders the resource
+func (i *Index) Add(appName string, key Key) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	for _, owner := range i.owners[key] {
+		if owner == appName {
+			return
+		}
+	}
+	i.owners[key] = append(i.owners[key], appName)
+}
+
+// Duplicates returns every resource rendered by more than one application, sorted by key. Keys are
+// normalised with scopes first, as applications may have been keyed before every cluster-scoped kind was known
+func (i *Index) Duplicates(scopes *Scopes) []Duplicate {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	owners := make(map[Key]map[string]bool)
+	for key, apps := range i.owners {
+		key = scopes.Normalise(key)
+		if owners[key] == nil {
+			owners[key] = make(map[string]bool)
+		}
+		for _, app := range apps {
+			owners[key][app] = true
+		}
+	}
+
+	var duplicates []Duplicate
+	for key, apps := range owners {
+		if len(apps) < 2 {
+			continue
+		}
+
+		var applications []string
+		for app := range apps {
+			applications = append(applications, app)
+		}
+		sort.Strings(applications)
+		duplicates = append(duplicates, Duplicate{Key: key, Applications: applications})
+	}
+
+	sort.Slice(duplicates, func(a, b int) bool {
+		return duplicates[a].Key.String() < duplicates[b].Key.String()
+	})
+	return duplicates
+}
@@ -0,0 +1,153 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+)
+
+// clusterScoped lists the built-in cluster-scoped kinds of current and recent Kubernetes versions, including alpha
+// and beta APIs and removed ones such as PodSecurityPolicy, keyed by Kind qualified with its API group
+var clusterScoped = map[string]bool{
+	"APIService.apiregistration.k8s.io":                           true,
+	"CertificateSigningRequest.certificates.k8s.io":               true,
+	"ClusterRole.rbac.authorization.k8s.io":                       true,
+	"ClusterRoleBinding.rbac.authorization.k8s.io":                true,
+	"ClusterTrustBundle.certificates.k8s.io":                      true,
+	"ComponentStatus":                                             true,
+	"CSIDriver.storage.k8s.io":                                    true,
+	"CSINode.storage.k8s.io":                                      true,
+	"CustomResourceDefinition.apiextensions.k8s.io":               true,
+	"DeviceClass.resource.k8s.io":                                 true,
+	"DeviceTaintRule.resource.k8s.io":                             true,
+	"FlowSchema.flowcontrol.apiserver.k8s.io":                     true,
+	"IngressClass.networking.k8s.io":                              true,
+	"IPAddress.networking.k8s.io":                                 true,
+	"MutatingAdmissionPolicy.admissionregistration.k8s.io":        true,
+	"MutatingAdmissionPolicyBinding.admissionregistration.k8s.io": true,
+	"MutatingWebhookConfiguration.admissionregistration.k8s.io":   true,
+	"Namespace":                       true,
+	"Node":                            true,
+	"PersistentVolume":                true,
+	"PodSecurityPolicy.policy":        true,
+	"PriorityClass.scheduling.k8s.io": true,
+	"PriorityLevelConfiguration.flowcontrol.apiserver.k8s.io":       true,
+	"ResourceSlice.resource.k8s.io":                                 true,
+	"RuntimeClass.node.k8s.io":                                      true,
+	"SelfSubjectAccessReview.authorization.k8s.io":                  true,
+	"SelfSubjectReview.authentication.k8s.io":                       true,
+	"SelfSubjectRulesReview.authorization.k8s.io":                   true,
+	"ServiceCIDR.networking.k8s.io":                                 true,
+	"StorageClass.storage.k8s.io":                                   true,
+	"StorageVersion.internal.apiserver.k8s.io":                      true,
+	"StorageVersionMigration.storagemigration.k8s.io":               true,
+	"SubjectAccessReview.authorization.k8s.io":                      true,
+	"TokenReview.authentication.k8s.io":                             true,
+	"ValidatingAdmissionPolicy.admissionregistration.k8s.io":        true,
+	"ValidatingAdmissionPolicyBinding.admissionregistration.k8s.io": true,
+	"ValidatingWebhookConfiguration.admissionregistration.k8s.io":   true,
+	"VolumeAttachment.storage.k8s.io":                               true,
+	"VolumeAttributesClass.storage.k8s.io":                          true,
+}
+
+// crdGroupKind is the Kind of CustomResourceDefinitions qualified with its API group
+const crdGroupKind = "CustomResourceDefinition.apiextensions.k8s.io"
+
+// Scopes tells cluster-scoped kinds from namespaced ones: the built-in cluster-scoped kinds, configured ones
+// and those of CustomResourceDefinitions with scope Cluster. It is safe for concurrent use
+type Scopes struct {
+	// mutex guards clusterScoped, as CRDs are added while applications are rendered concurrently
+	mutex sync.RWMutex
+
+	// clusterScoped holds the cluster-scoped kinds, keyed by Kind qualified with its API group
+	clusterScoped map[string]bool
+}
+
+// NewScopes creates scopes knowing the built-in cluster-scoped kinds and the given ones, each a Kind
+// qualified with its API group, e.g. ClusterIssuer.cert-manager.io
+func NewScopes(clusterScopedKinds []string) *Scopes {
+	scopes := &Scopes{clusterScoped: make(map[string]bool, len(clusterScoped)+len(clusterScopedKinds))}
+	for groupKind := range clusterScoped {
+		scopes.clusterScoped[groupKind] = true
+	}
+	scopes.Add(clusterScopedKinds...)
+	return scopes
+}
+
+// Add records cluster-scoped kinds, each a Kind qualified with its API group
+func (s *Scopes) Add(groupKinds ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, groupKind := range groupKinds {
+		s.clusterScoped[groupKind] = true
+	}
+}
+
+// AddCRDs records the kinds of the cluster-scoped CustomResourceDefinitions among manifests, and returns them sorted
+func (s *Scopes) AddCRDs(manifests []hydrate.ManifestInfo) ([]string, error) {
+	var groupKinds []string
+	for _, manifest := range manifests {
+		if manifest.GroupKind() != crdGroupKind {
+			continue
+		}
+
+		var crd struct {
+			Spec struct {
+				Group string `yaml:"group"`
+				Names struct {
+					Kind string `yaml:"kind"`
+				} `yaml:"names"`
+				Scope string `yaml:"scope"`
+			} `yaml:"spec"`
+		}
+		if err := yaml.Unmarshal([]byte(manifest.Content), &crd); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", manifest, err)
+		}
+
+		if crd.Spec.Scope == "Cluster" && crd.Spec.Names.Kind != "" {
+			groupKinds = append(groupKinds, Key{Group: crd.Spec.Group, Kind: crd.Spec.Names.Kind}.GroupKind())
+		}
+	}
+
+	sort.Strings(groupKinds)
+	s.Add(groupKinds...)
+	return groupKinds, nil
+}
+
+// ClusterScoped returns true if the kind, qualified with its API group, is cluster-scoped
+func (s *Scopes) ClusterScoped(groupKind string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.clusterScoped[groupKind]
+}
+
+// KeyOf returns the key of a manifest. Namespaced resources without an explicit namespace
+// are placed in defaultNamespace, like Argo CD does with the application's destination namespace
+func (s *Scopes) KeyOf(manifest hydrate.ManifestInfo, defaultNamespace string) Key {
+	namespace := manifest.Namespace
+	if namespace == "" && !s.ClusterScoped(manifest.GroupKind()) {
+		namespace = defaultNamespace
+	}
+
+	return Key{
+		Group:     manifest.Group(),
+		Kind:      manifest.Kind,
+		Namespace: namespace,
+		Name:      manifest.Name,
+	}
+}
+
+// Normalise removes the namespace from the key of a cluster-scoped resource, which may have been given one
+// before its kind was known to be cluster-scoped
+func (s *Scopes) Normalise(key Key) Key {
+	if s.ClusterScoped(key.GroupKind()) {
+		key.Namespace = ""
+	}
+	return key
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options holds the settings every logger of a run is created with
+type Options struct {
+	// Level is the minimum level of logged records
+	Level slog.Level
+
+	// Format is the record format, FormatText or FormatJSON
+	Format string
+}
+
+// ParseOptions validates the log level and format given on the command line
+func ParseOptions(level, format string) (Options, error) {
+	var options Options
+	if err := options.Level.UnmarshalText([]byte(level)); err != nil {
+		return Options{}, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+
+	format = strings.ToLower(format)
+	if format != FormatText && format != FormatJSON {
+		return Options{}, fmt.Errorf("invalid log format %q, expected %s or %s", format, FormatText, FormatJSON)
+	}
+	options.Format = format
+
+	return options, nil
+}
+
+// New creates a logger writing records to w
+func (o Options) New(w io.Writer) *slog.Logger {
+	handlerOptions := &slog.HandlerOptions{Level: o.Level}
+	if o.Format == FormatJSON {
+		return slog.New(slog.NewJSONHandler(w, handlerOptions))
+	}
+	return slog.New(slog.NewTextHandler(w, handlerOptions))
+}
+
+// Discard returns a logger that drops every record
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
@@ -0,0 +1,82 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+)
+
+// Memory collects the rendered files of applications in memory instead of writing them to disk
+type Memory struct {
+	// mutex guards files, as applications are collected concurrently
+	mutex sync.Mutex
+
+	// files holds the collected files
+	files []File
+}
+
+// Stage collects the files of an application; the state is not needed in memory
+func (m *Memory) Stage(appName string, files []File, state hydrate.State) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.files = append(m.files, files...)
+	return nil
+}
+
+// UpdateState does nothing, as the state is not needed in memory
+func (m *Memory) UpdateState(appName string, state hydrate.State) error {
+	return nil
+}
+
+// Files returns all collected files
+func (m *Memory) Files() []File {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]File(nil), m.files...)
+}
+
+// Changes lists the differences between rendered files and the contents of the output directory
+type Changes struct {
+	Added    []string
+	Modified []string
+	Deleted  []string
+}
+
+// Empty returns true if there are no differences
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Modified) == 0 && len(c.Deleted) == 0
+}
+
+// Compare compares rendered files with the contents of the output directory. Deleted files are the
+// stale paths a run would prune, as reported by StaleFiles
+func Compare(outputDir string, files []File, stale []string) (Changes, error) {
+	var changes Changes
+
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(outputDir, file.Path))
+		if os.IsNotExist(err) {
+			changes.Added = append(changes.Added, file.Path)
+			continue
+		}
+		if err != nil {
+			return changes, fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+
+		if string(content) != file.Content {
+			changes.Modified = append(changes.Modified, file.Path)
+		}
+	}
+
+	changes.Deleted = append(changes.Deleted, stale...)
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Modified)
+	sort.Strings(changes.Deleted)
+	return changes, nil
+}
@@ -0,0 +1,197 @@
+package output
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+	"github.com/kazysgurskas/argocd-hydrate/pkg/util"
+)
+
+// Built-in layout names
+const (
+	LayoutTree     = "tree"
+	LayoutManifest = "manifest"
+	LayoutKind     = "kind"
+	LayoutFlat     = "flat"
+	LayoutTemplate = "template"
+)
+
+// Resource holds the fields of a manifest that output paths are built from
+type Resource struct {
+	App       string
+	Namespace string
+	Group     string
+	Version   string
+	Kind      string
+	Name      string
+}
+
+// Layout decides where manifests are written within an application's output directory
+type Layout interface {
+	// Path returns the file path of a resource, relative to the application's output directory
+	Path(resource Resource) (string, error)
+
+	// Shared returns true if resources are meant to share files, in which case they are concatenated
+	Shared() bool
+}
+
+// NewLayout returns the built-in layout with the given name. The template layout builds paths
+// from pathTemplate, a Go template executed with a Resource
+func NewLayout(name, pathTemplate string) (Layout, error) {
+	switch name {
+	case LayoutTree:
+		return treeLayout{}, nil
+	case LayoutManifest:
+		return manifestLayout{}, nil
+	case LayoutKind:
+		return kindLayout{}, nil
+	case LayoutFlat:
+		return flatLayout{}, nil
+	case LayoutTemplate:
+		if pathTemplate == "" {
+			return nil, fmt.Errorf("the %s layout requires a path template", LayoutTemplate)
+		}
+		tmpl, err := template.New("layout").Option("missingkey=error").Parse(pathTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid layout template: %w", err)
+		}
+		return templateLayout{template: tmpl}, nil
+	default:
+		return nil, fmt.Errorf("unknown layout %q, expected one of %s, %s, %s, %s or %s",
+			name, LayoutTree, LayoutManifest, LayoutKind, LayoutFlat, LayoutTemplate)
+	}
+}
+
+// treeLayout writes each resource to <namespace>/<Kind>.<group>/<name>.yaml, or <Kind>.<group>/<name>.yaml
+// for cluster-scoped resources. Resources of the core group use just <Kind> as their directory
+type treeLayout struct{}
+
+func (treeLayout) Path(resource Resource) (string, error) {
+	kindDir := resource.Kind
+	if resource.Group != "" {
+		kindDir = resource.Kind + "." + resource.Group
+	}
+
+	if resource.Namespace != "" {
+		return path.Join(resource.Namespace, kindDir, resource.Name+".yaml"), nil
+	}
+	return path.Join(kindDir, resource.Name+".yaml"), nil
+}
+
+func (treeLayout) Shared() bool { return false }
+
+// manifestLayout writes all resources of an application to a single manifest.yaml
+type manifestLayout struct{}
+
+func (manifestLayout) Path(resource Resource) (string, error) {
+	return "manifest.yaml", nil
+}
+
+func (manifestLayout) Shared() bool { return true }
+
+// kindLayout writes all resources of the same Kind to <Kind>.yaml
+type kindLayout struct{}
+
+func (kindLayout) Path(resource Resource) (string, error) {
+	return resource.Kind + ".yaml", nil
+}
+
+func (kindLayout) Shared() bool { return true }
+
+// flatLayout writes each resource to <kind>-<name>.yaml
+type flatLayout struct{}
+
+func (flatLayout) Path(resource Resource) (string, error) {
+	return fmt.Sprintf("%s-%s.yaml", strings.ToLower(resource.Kind), resource.Name), nil
+}
+
+func (flatLayout) Shared() bool { return false }
+
+// templateLayout builds each resource's path from a user-defined Go template
+type templateLayout struct {
+	template *template.Template
+}
+
+func (l templateLayout) Path(resource Resource) (string, error) {
+	var buffer bytes.Buffer
+	if err := l.template.Execute(&buffer, resource); err != nil {
+		return "", fmt.Errorf("failed to execute layout template: %w", err)
+	}
+	return buffer.String(), nil
+}
+
+func (templateLayout) Shared() bool { return false }
+
+// ApplicationFiles maps the manifests of an application to files in the application's output directory
+// according to the layout. Manifests that share a file are concatenated in order; for layouts that write
+// each resource to its own file, two resources mapping to the same path are an error. Paths that differ
+// only in case, and would collide on case-insensitive filesystems, get a hash suffix
+func ApplicationFiles(layout Layout, appName string, manifests []hydrate.ManifestInfo) ([]File, error) {
+	var files []File
+	index := make(map[string]int)
+	owners := make(map[string]hydrate.ManifestInfo)
+	folded := make(map[string]string)
+
+	for _, manifest := range manifests {
+		resource := Resource{
+			App:       appName,
+			Namespace: util.SanitizeFileName(manifest.Namespace),
+			Group:     manifest.Group(),
+			Version:   manifest.Version(),
+			Kind:      manifest.Kind,
+			Name:      util.SanitizeFileName(manifest.Name),
+		}
+
+		relPath, err := layout.Path(resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build path for %s: %w", manifest, err)
+		}
+
+		// Keep every file inside the application's output directory
+		relPath = path.Clean(relPath)
+		if relPath == "." || path.IsAbs(relPath) || relPath == ".." || strings.HasPrefix(relPath, "../") {
+			return nil, fmt.Errorf("path %q for %s is outside the application directory", relPath, manifest)
+		}
+		filePath := filepath.Join(appName, filepath.FromSlash(relPath))
+
+		// Keep paths apart that only differ in case
+		if existing, ok := folded[strings.ToLower(filePath)]; ok && existing != filePath {
+			filePath = hashSuffix(filePath)
+		}
+		folded[strings.ToLower(filePath)] = filePath
+
+		if i, ok := index[filePath]; ok {
+			if !layout.Shared() {
+				return nil, fmt.Errorf("%s and %s both map to %s", owners[filePath], manifest, filePath)
+			}
+			files[i].Content += manifest.Content
+			files[i].Manifests = append(files[i].Manifests, manifest)
+			continue
+		}
+
+		index[filePath] = len(files)
+		owners[filePath] = manifest
+		files = append(files, File{
+			Path:      filePath,
+			Content:   manifest.Content,
+			Manifests: []hydrate.ManifestInfo{manifest},
+		})
+	}
+
+	return files, nil
+}
+
+// hashSuffix inserts a short hash of the path before its extension, e.g. Foo~1a2b3c4d.yaml.
+// The '~' separator never appears in sanitised names, so the result cannot collide with them
+func hashSuffix(filePath string) string {
+	sum := sha256.Sum256([]byte(filePath))
+	ext := filepath.Ext(filePath)
+	return fmt.Sprintf("%s~%s%s", strings.TrimSuffix(filePath, ext), hex.EncodeToString(sum[:4]), ext)
+}
@@ -0,0 +1,42 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+)
+
+// File is a rendered file, with its path relative to the output directory
+type File struct {
+	Path    string
+	Content string
+
+	// Manifests holds the manifests written to the file
+	Manifests []hydrate.ManifestInfo
+}
+
+// Writer receives the rendered files and state of applications
+type Writer interface {
+	Stage(appName string, files []File, state hydrate.State) error
+
+	// UpdateState replaces the state of an application that was already staged
+	UpdateState(appName string, state hydrate.State) error
+}
+
+// WriteFiles writes files into the output directory, creating directories as needed
+func WriteFiles(outputDir string, files []File) error {
+	for _, file := range files {
+		outputFile := filepath.Join(outputDir, file.Path)
+
+		if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(outputFile), err)
+		}
+
+		if err := os.WriteFile(outputFile, []byte(file.Content), 0644); err != nil {
+			return fmt.Errorf("failed to write manifest %s: %w", outputFile, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package output
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processRunning returns true if a process with the given ID exists
+func processRunning(pid int) bool {
+	// Signal 0 only checks whether the process exists, which it does if it belongs to another user
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
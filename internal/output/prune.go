@@ -0,0 +1,144 @@
+package output
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+)
+
+// Pruning modes
+const (
+	PruneOff    = "false"
+	PruneOn     = "true"
+	PruneDryRun = "dry-run"
+)
+
+// StaleFiles lists stale paths in the output directory: files in the directories of the given applications
+// that were not produced by this run, and directories of applications that are no longer defined.
+// Only application directories are considered; the directory of an application that is not defined any more
+// is recognised by the state file hydration leaves in it. Directory paths end with a path separator.
+func StaleFiles(outputDir string, applications, managed []string, produced map[string]bool) ([]string, error) {
+	var stale []string
+
+	// Files inside the directories of applications whose files are known
+	for _, appName := range managed {
+		appStale, err := staleFiles(outputDir, appName, produced)
+		if err != nil {
+			return nil, err
+		}
+		stale = append(stale, appStale...)
+	}
+
+	// Directories of applications that are no longer defined
+	known := make(map[string]bool)
+	for _, appName := range applications {
+		known[appName] = true
+	}
+
+	entries, err := os.ReadDir(outputDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read output directory %s: %w", outputDir, err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || known[entry.Name()] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(outputDir, entry.Name(), hydrate.StateFileName)); err == nil {
+			stale = append(stale, entry.Name()+string(filepath.Separator))
+		}
+	}
+
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// Prune removes stale paths from the output directory, along with directories left empty
+// inside the directories of the given applications
+func Prune(logger *slog.Logger, outputDir string, stale, managed []string) error {
+	for _, path := range stale {
+		logger.Info("Pruning", "path", filepath.Join(outputDir, path))
+		if err := os.RemoveAll(filepath.Join(outputDir, path)); err != nil {
+			return fmt.Errorf("failed to prune %s: %w", path, err)
+		}
+	}
+
+	for _, appName := range managed {
+		if err := removeEmptyDirs(filepath.Join(outputDir, appName)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// staleFiles lists the files in an application's output directory that were not produced by this run
+func staleFiles(outputDir, appName string, produced map[string]bool) ([]string, error) {
+	var stale []string
+
+	appDir := filepath.Join(outputDir, appName)
+	err := filepath.WalkDir(appDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || (filepath.Dir(path) == appDir && entry.Name() == hydrate.StateFileName) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		if !produced[relPath] {
+			stale = append(stale, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan application directory %s: %w", appDir, err)
+	}
+
+	return stale, nil
+}
+
+// removeEmptyDirs removes empty directories below root, deepest first, keeping root itself
+func removeEmptyDirs(root string) error {
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() && path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+
+	// Walk order lists parents before children, so reverse it to remove children first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", dirs[i], err)
+		}
+		if len(entries) == 0 {
+			if err := os.Remove(dirs[i]); err != nil {
+				return fmt.Errorf("failed to remove empty directory %s: %w", dirs[i], err)
+			}
+		}
+	}
+	return nil
+}
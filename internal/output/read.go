@@ -0,0 +1,70 @@
+package output
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+)
+
+// ReadApplication reads the manifests of an application from its directory in the output directory,
+// in the order of their file paths. A missing directory has no manifests
+func ReadApplication(outputDir, appName string) ([]hydrate.ManifestInfo, error) {
+	appDir := filepath.Join(outputDir, appName)
+
+	var manifests []hydrate.ManifestInfo
+	err := filepath.WalkDir(appDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == appDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(path, ".yaml") {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		fileManifests, err := hydrate.ParseManifests(string(content))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		manifests = append(manifests, fileManifests...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output of application %s: %w", appName, err)
+	}
+
+	return manifests, nil
+}
+
+// Applications returns the names of the application directories in the output directory,
+// recognised by the state file hydration leaves in them
+func Applications(outputDir string) ([]string, error) {
+	entries, err := os.ReadDir(outputDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output directory %s: %w", outputDir, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(outputDir, entry.Name(), hydrate.StateFileName)); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
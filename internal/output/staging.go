@@ -0,0 +1,278 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+)
+
+// Staging collects the output of rendered applications in a staging directory inside the output directory,
+// so that nothing in the output directory changes until every application has been rendered successfully
+type Staging struct {
+	// outputDir is the output directory the staged applications are swapped into
+	outputDir string
+
+	// dir is the staging directory
+	dir string
+
+	// mutex guards apps, as applications are staged concurrently
+	mutex sync.Mutex
+
+	// apps holds the names of the staged applications
+	apps []string
+}
+
+// stagingPattern is the pattern of staging directory names
+const stagingPattern = ".staging-*"
+
+// ownerFileName is the name of the file recording the host and process ID of the run owning a staging directory
+const ownerFileName = ".owner"
+
+// unownedGracePeriod is how old a staging directory without an owner file must be to be considered left behind,
+// as the owner file is written right after the directory is created
+const unownedGracePeriod = time.Minute
+
+// NewStaging creates a new staging directory inside outputDir, so that applications are swapped in with renames
+// on the same filesystem. Staging directories left behind by runs that were killed are removed first, while those
+// of runs that are still going, e.g. a concurrent run on the same output directory, are kept
+func NewStaging(outputDir string) (*Staging, error) {
+	leftovers, err := filepath.Glob(filepath.Join(outputDir, stagingPattern))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staging directories in %s: %w", outputDir, err)
+	}
+	for _, leftover := range leftovers {
+		if !leftBehind(leftover) {
+			continue
+		}
+		if err := os.RemoveAll(leftover); err != nil {
+			return nil, fmt.Errorf("failed to remove leftover staging directory %s: %w", leftover, err)
+		}
+	}
+
+	dir, err := os.MkdirTemp(outputDir, stagingPattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory in %s: %w", outputDir, err)
+	}
+
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s\n%d\n", hostname, os.Getpid())
+	if err := os.WriteFile(filepath.Join(dir, ownerFileName), []byte(owner), 0644); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to write owner of staging directory %s: %w", dir, err)
+	}
+
+	return &Staging{outputDir: outputDir, dir: dir}, nil
+}
+
+// leftBehind returns true if a staging directory belongs to a run that no longer exists: one on this host whose
+// process has exited. Staging directories of runs on other hosts sharing the output directory are kept, as are
+// those without an owner unless they are older than unownedGracePeriod
+func leftBehind(dir string) bool {
+	content, err := os.ReadFile(filepath.Join(dir, ownerFileName))
+	if os.IsNotExist(err) {
+		info, err := os.Stat(dir)
+		return err == nil && time.Since(info.ModTime()) > unownedGracePeriod
+	}
+	if err != nil {
+		return false
+	}
+
+	var host string
+	var pid int
+	if _, err := fmt.Sscanf(string(content), "%s\n%d\n", &host, &pid); err != nil {
+		return false
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || host != hostname {
+		return false
+	}
+	return pid != os.Getpid() && !processRunning(pid)
+}
+
+// AppDir returns the staging directory of an application
+func (s *Staging) AppDir(appName string) string {
+	return filepath.Join(s.dir, appName)
+}
+
+// Stage writes the files and state of an application into the staging directory
+func (s *Staging) Stage(appName string, files []File, state hydrate.State) error {
+	if err := os.MkdirAll(s.AppDir(appName), 0755); err != nil {
+		return fmt.Errorf("failed to create staging directory for application %s: %w", appName, err)
+	}
+
+	if err := WriteFiles(s.dir, files); err != nil {
+		return err
+	}
+
+	if err := hydrate.WriteState(s.AppDir(appName), state); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.apps = append(s.apps, appName)
+	s.mutex.Unlock()
+	return nil
+}
+
+// UpdateState replaces the state of an application in the staging directory
+func (s *Staging) UpdateState(appName string, state hydrate.State) error {
+	return hydrate.WriteState(s.AppDir(appName), state)
+}
+
+// Commit validates the staged applications and swaps each of them into the output directory.
+// When preserveStale is set, files in the previous output of an application that were not produced
+// again are carried over. If any swap fails, the applications already swapped are rolled back.
+func (s *Staging) Commit(preserveStale bool) error {
+	sort.Strings(s.apps)
+
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	previousDir := filepath.Join(s.dir, ".previous")
+	if err := os.MkdirAll(previousDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", previousDir, err)
+	}
+
+	var swapped []string
+	for _, appName := range s.apps {
+		if err := s.swap(appName, previousDir, preserveStale); err != nil {
+			if rollbackErr := s.rollback(swapped, previousDir); rollbackErr != nil {
+				return fmt.Errorf("%w; rollback failed: %v", err, rollbackErr)
+			}
+			return err
+		}
+		swapped = append(swapped, appName)
+	}
+
+	return s.Discard()
+}
+
+// Discard removes the staging directory, along with the previous output of swapped applications
+func (s *Staging) Discard() error {
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("failed to remove staging directory %s: %w", s.dir, err)
+	}
+	return nil
+}
+
+// validate makes sure every staged YAML file can be parsed
+func (s *Staging) validate() error {
+	for _, appName := range s.apps {
+		err := filepath.WalkDir(s.AppDir(appName), func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || !strings.HasSuffix(path, ".yaml") {
+				return nil
+			}
+
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			decoder := yaml.NewDecoder(file)
+			for {
+				var doc yaml.Node
+				if err := decoder.Decode(&doc); errors.Is(err, io.EOF) {
+					return nil
+				} else if err != nil {
+					return fmt.Errorf("invalid YAML in %s: %w", path, err)
+				}
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to validate staged output of application %s: %w", appName, err)
+		}
+	}
+	return nil
+}
+
+// swap moves an application's previous output aside and its staged output into place
+func (s *Staging) swap(appName, previousDir string, preserveStale bool) error {
+	target := filepath.Join(s.outputDir, appName)
+	staged := s.AppDir(appName)
+
+	if _, err := os.Stat(target); err == nil {
+		if preserveStale {
+			if err := copyMissing(target, staged); err != nil {
+				return fmt.Errorf("failed to preserve previous output of application %s: %w", appName, err)
+			}
+		}
+
+		if err := os.Rename(target, filepath.Join(previousDir, appName)); err != nil {
+			return fmt.Errorf("failed to move previous output of application %s aside: %w", appName, err)
+		}
+	}
+
+	if err := os.Rename(staged, target); err != nil {
+		// Put the previous output back before reporting the failure
+		if _, statErr := os.Stat(filepath.Join(previousDir, appName)); statErr == nil {
+			os.Rename(filepath.Join(previousDir, appName), target)
+		}
+		return fmt.Errorf("failed to move output of application %s into place: %w", appName, err)
+	}
+
+	return nil
+}
+
+// rollback restores the previous output of the given applications
+func (s *Staging) rollback(apps []string, previousDir string) error {
+	for _, appName := range apps {
+		target := filepath.Join(s.outputDir, appName)
+		previous := filepath.Join(previousDir, appName)
+
+		if err := os.Rename(target, s.AppDir(appName)); err != nil {
+			return fmt.Errorf("failed to move output of application %s back to staging: %w", appName, err)
+		}
+
+		if _, err := os.Stat(previous); err == nil {
+			if err := os.Rename(previous, target); err != nil {
+				return fmt.Errorf("failed to restore previous output of application %s: %w", appName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// copyMissing copies files from src to dst that do not exist in dst yet
+func copyMissing(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if _, err := os.Stat(target); err == nil {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, content, 0644)
+	})
+}
@@ -0,0 +1,186 @@
+package plugin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kind is the kind of Config Management Plugin definitions
+const Kind = "ConfigManagementPlugin"
+
+// Plugin is a Config Management Plugin definition in Argo CD's plugin.yaml format
+type Plugin struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Version  string    `yaml:"version,omitempty"`
+		Init     *Command  `yaml:"init,omitempty"`
+		Generate Command   `yaml:"generate"`
+		Discover *Discover `yaml:"discover,omitempty"`
+	} `yaml:"spec"`
+
+	// Path is the file the plugin was defined in
+	Path string `yaml:"-"`
+}
+
+// Command is a command of a plugin, run without a shell
+type Command struct {
+	Command []string `yaml:"command,omitempty"`
+	Args    []string `yaml:"args,omitempty"`
+}
+
+// Discover holds the rules a source directory must match for a plugin to be used without naming it
+type Discover struct {
+	// FileName is a glob pattern, relative to the source directory, of files that must exist
+	FileName string `yaml:"fileName,omitempty"`
+
+	// Find holds a recursive glob pattern or a command whose output must not be empty
+	Find *Find `yaml:"find,omitempty"`
+}
+
+// Find matches a source directory by a recursive glob pattern, in which ** matches any number of
+// directories, or by a command that prints something
+type Find struct {
+	Command `yaml:",inline"`
+	Glob    string `yaml:"glob,omitempty"`
+}
+
+// Name returns the name applications refer to the plugin by, which includes its version if it has one
+func (p *Plugin) Name() string {
+	if p.Spec.Version != "" {
+		return p.Metadata.Name + "-" + p.Spec.Version
+	}
+	return p.Metadata.Name
+}
+
+// String returns the command line of a command
+func (c Command) String() string {
+	return strings.Join(append(append([]string{}, c.Command...), c.Args...), " ")
+}
+
+// Registry holds the plugins available to applications and runs their commands
+type Registry struct {
+	plugins []*Plugin
+	timeout time.Duration
+	digest  string
+}
+
+// NewRegistry loads the plugins defined in the given files, or in the .yaml files of the given directories,
+// whose commands are stopped after timeout, or never if it is zero
+func NewRegistry(paths []string, timeout time.Duration) (*Registry, error) {
+	registry := &Registry{timeout: timeout}
+	names := make(map[string]string)
+	h := sha256.New()
+
+	for _, path := range paths {
+		files, err := definitionFiles(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read plugin definition %s: %w", file, err)
+			}
+			h.Write(content)
+
+			plugins, err := parsePlugins(content, file)
+			if err != nil {
+				return nil, err
+			}
+			for _, plugin := range plugins {
+				if previous, ok := names[plugin.Name()]; ok {
+					return nil, fmt.Errorf("plugin %s is defined in both %s and %s", plugin.Name(), previous, file)
+				}
+				names[plugin.Name()] = file
+				registry.plugins = append(registry.plugins, plugin)
+			}
+		}
+	}
+
+	registry.digest = "sha256:" + hex.EncodeToString(h.Sum(nil))
+	return registry, nil
+}
+
+// definitionFiles returns path if it is a file, or the .yaml files directly within it if it is a directory
+func definitionFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("plugin definition %s not found: %w", path, err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plugin definitions in %s: %w", path, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// parsePlugins parses the ConfigManagementPlugin documents of a file, ignoring documents of other kinds
+func parsePlugins(content []byte, file string) ([]*Plugin, error) {
+	var plugins []*Plugin
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		plugin := &Plugin{Path: file}
+		err := decoder.Decode(plugin)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse plugin definition %s: %w", file, err)
+		}
+		if plugin.Kind != Kind {
+			continue
+		}
+
+		if plugin.Metadata.Name == "" {
+			return nil, fmt.Errorf("plugin in %s has no name", file)
+		}
+		if len(plugin.Spec.Generate.Command) == 0 {
+			return nil, fmt.Errorf("plugin %s in %s has no generate command", plugin.Name(), file)
+		}
+		plugins = append(plugins, plugin)
+	}
+
+	return plugins, nil
+}
+
+// Digest returns a hash of the plugin definitions, for fingerprinting
+func (r *Registry) Digest() string {
+	return r.digest
+}
+
+// Empty returns true if no plugins are defined, which is also the case for a nil registry
+func (r *Registry) Empty() bool {
+	return r == nil || len(r.plugins) == 0
+}
+
+// Lookup returns the plugin applications refer to by name
+func (r *Registry) Lookup(name string) (*Plugin, error) {
+	for _, plugin := range r.plugins {
+		if plugin.Name() == name {
+			return plugin, nil
+		}
+	}
+	return nil, fmt.Errorf("plugin %s is not defined", name)
+}
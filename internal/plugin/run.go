@@ -0,0 +1,194 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// waitDelay is how long a command's output is waited for after it exits or is killed
+const waitDelay = time.Second
+
+// Discover returns the first plugin, in the order they were defined, whose discovery rules match the source
+// directory dir. Plugins without discovery rules are only used when named. The environment of find commands
+// is env
+func (r *Registry) Discover(logger *slog.Logger, dir string, env []string) (*Plugin, error) {
+	for _, plugin := range r.plugins {
+		if plugin.Spec.Discover == nil {
+			continue
+		}
+
+		matched, err := r.matches(logger, plugin, dir, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover plugin %s: %w", plugin.Name(), err)
+		}
+		if matched {
+			logger.Debug("Discovered plugin", "plugin", plugin.Name(), "path", dir)
+			return plugin, nil
+		}
+	}
+	return nil, fmt.Errorf("no plugin supports %s", dir)
+}
+
+// matches returns true if the discovery rules of a plugin match dir, which is the case when any rule does
+func (r *Registry) matches(logger *slog.Logger, plugin *Plugin, dir string, env []string) (bool, error) {
+	discover := plugin.Spec.Discover
+
+	if discover.FileName != "" {
+		files, err := filepath.Glob(filepath.Join(dir, discover.FileName))
+		if err != nil {
+			return false, fmt.Errorf("invalid fileName %q: %w", discover.FileName, err)
+		}
+		if len(files) > 0 {
+			return true, nil
+		}
+	}
+
+	if discover.Find == nil {
+		return false, nil
+	}
+
+	if discover.Find.Glob != "" {
+		matched, err := globMatches(dir, discover.Find.Glob)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+
+	if len(discover.Find.Command.Command) > 0 {
+		output, err := r.run(logger, discover.Find.Command, dir, env)
+		if err != nil {
+			return false, err
+		}
+		if len(bytes.TrimSpace(output)) > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// globMatches returns true if a file under dir matches pattern, in which ** matches any number of directories
+func globMatches(dir, pattern string) (bool, error) {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	if _, err := path.Match(pattern, ""); err != nil {
+		return false, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	patternParts := strings.Split(pattern, "/")
+
+	errFound := errors.New("found")
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		if matchParts(patternParts, strings.Split(filepath.ToSlash(rel), "/")) {
+			return errFound
+		}
+		return nil
+	})
+	if errors.Is(err, errFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to search %s: %w", dir, err)
+	}
+	return false, nil
+}
+
+// matchParts matches the segments of a path against those of a glob pattern, where a ** segment matches
+// zero or more segments
+func matchParts(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchParts(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(parts) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], parts[0]); !matched {
+		return false
+	}
+	return matchParts(pattern[1:], parts[1:])
+}
+
+// Generate runs the init command of a plugin, if it has one, and then its generate command in the source
+// directory dir with the environment env, returning the manifests the generate command printed
+func (r *Registry) Generate(logger *slog.Logger, plugin *Plugin, dir string, env []string) (string, error) {
+	logger = logger.With("plugin", plugin.Name())
+
+	if plugin.Spec.Init != nil && len(plugin.Spec.Init.Command) > 0 {
+		logger.Debug("Running plugin init command", "command", plugin.Spec.Init.String())
+		if _, err := r.run(logger, *plugin.Spec.Init, dir, env); err != nil {
+			return "", fmt.Errorf("init command of plugin %s failed: %w", plugin.Name(), err)
+		}
+	}
+
+	logger.Info("Running plugin", "path", dir)
+	output, err := r.run(logger, plugin.Spec.Generate, dir, env)
+	if err != nil {
+		return "", fmt.Errorf("generate command of plugin %s failed: %w", plugin.Name(), err)
+	}
+	return string(output), nil
+}
+
+// run runs a command in dir with the environment env, stopping it after the timeout, and returns its stdout.
+// The command's stderr is included in errors and logged at debug level otherwise
+func (r *Registry) run(logger *slog.Logger, command Command, dir string, env []string) ([]byte, error) {
+	ctx := context.Background()
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	args := append(append([]string{}, command.Command[1:]...), command.Args...)
+	cmd := exec.CommandContext(ctx, command.Command[0], args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	// Children of a killed command, e.g. of sh -c, may hold on to its output, so stop waiting for them
+	cmd.WaitDelay = waitDelay
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s timed out after %s", command, r.timeout)
+	}
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s: %w: %s", command, err, message)
+		}
+		return nil, fmt.Errorf("%s: %w", command, err)
+	}
+
+	if message := strings.TrimSpace(stderr.String()); message != "" {
+		logger.Debug("Plugin command output", "command", command.String(), "stderr", message)
+	}
+	return stdout.Bytes(), nil
+}
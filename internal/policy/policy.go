@@ -0,0 +1,306 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apiserver/pkg/cel/library"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/application"
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+)
+
+// Severities of rules, from least to most severe
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// ExemptionAnnotation is the annotation exempting a resource from rules, holding a comma-separated list of
+// rule names, or * for every rule
+const ExemptionAnnotation = "argocd-hydrate/policy-exemptions"
+
+// Rule is a policy every matching resource must satisfy
+type Rule struct {
+	// Name identifies the rule in results and exemptions
+	Name string `yaml:"name"`
+
+	// Description explains the rule, and is reported for violations without a message
+	Description string `yaml:"description,omitempty"`
+
+	// Severity is info, warning or error, the default
+	Severity string `yaml:"severity,omitempty"`
+
+	// Match selects the resources the rule applies to, every resource when empty
+	Match Match `yaml:"match,omitempty"`
+
+	// Expression is a CEL expression that must evaluate to true for the resource, which is available as
+	// object, and its application, available as application with name, namespace, project and labels
+	Expression string `yaml:"expression"`
+
+	// Message is reported for violations of the rule
+	Message string `yaml:"message,omitempty"`
+}
+
+// Match selects resources by kind, namespace and application. Every non-empty list must match
+type Match struct {
+	// Kinds lists the kinds, e.g. Deployment, or kinds qualified with their API group, e.g. Deployment.apps
+	Kinds []string `yaml:"kinds,omitempty"`
+
+	// Namespaces lists glob patterns of resource namespaces
+	Namespaces []string `yaml:"namespaces,omitempty"`
+
+	// Applications lists glob patterns of application names
+	Applications []string `yaml:"applications,omitempty"`
+}
+
+// rulesFile is the format of a rules file
+type rulesFile struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Violation is a resource failing a rule
+type Violation struct {
+	// Rule is the name of the failed rule
+	Rule string
+
+	// Severity is the severity of the failed rule
+	Severity string
+
+	// Message describes the violation
+	Message string
+}
+
+// Result is the outcome of evaluating every rule against a resource
+type Result struct {
+	// Violations lists the failed rules
+	Violations []Violation
+
+	// Exempted lists the rules the resource was exempted from by annotation
+	Exempted []string
+}
+
+// compiledRule is a rule with its compiled expression
+type compiledRule struct {
+	Rule
+	program cel.Program
+}
+
+// Engine evaluates rules against manifests
+type Engine struct {
+	rules []compiledRule
+}
+
+// LoadRules reads and compiles the rules of a rules file
+func LoadRules(filePath string) (*Engine, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file %s: %w", filePath, err)
+	}
+
+	var file rulesFile
+	decoder := yaml.NewDecoder(strings.NewReader(string(content)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file %s: %w", filePath, err)
+	}
+
+	engine, err := NewEngine(file.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %w", filePath, err)
+	}
+	return engine, nil
+}
+
+// NewEngine compiles rules, making sure every rule has a unique name, a known severity and a boolean expression
+func NewEngine(rules []Rule) (*Engine, error) {
+	// Besides the standard library, offer the string extensions and the Kubernetes libraries of admission policies
+	env, err := cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.Variable("application", cel.DynType),
+		ext.Strings(),
+		library.Lists(),
+		library.Regex(),
+		library.URLs(),
+		library.Quantity(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+
+	engine := &Engine{}
+	names := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule without a name")
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate rule %s", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Severity == "" {
+			rule.Severity = SeverityError
+		}
+		if _, err := SeverityLevel(rule.Severity); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+
+		ast, issues := env.Compile(rule.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("rule %s: failed to compile expression: %w", rule.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("rule %s: expression must evaluate to a bool, not %s", rule.Name, ast.OutputType())
+		}
+
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: failed to compile expression: %w", rule.Name, err)
+		}
+		engine.rules = append(engine.rules, compiledRule{Rule: rule, program: program})
+	}
+
+	return engine, nil
+}
+
+// SeverityLevel returns the rank of a severity, higher being more severe
+func SeverityLevel(severity string) (int, error) {
+	switch severity {
+	case SeverityInfo:
+		return 0, nil
+	case SeverityWarning:
+		return 1, nil
+	case SeverityError:
+		return 2, nil
+	}
+	return 0, fmt.Errorf("invalid severity %q, must be %s, %s or %s", severity, SeverityInfo, SeverityWarning, SeverityError)
+}
+
+// Evaluate evaluates every matching rule against a manifest of an application. namespace is the
+// namespace of the resource, defaulted to the application's destination namespace
+func (e *Engine) Evaluate(manifest hydrate.ManifestInfo, app application.Application, namespace string) (Result, error) {
+	var result Result
+
+	var object map[string]interface{}
+	if err := yaml.Unmarshal([]byte(manifest.Content), &object); err != nil {
+		return result, fmt.Errorf("failed to parse %s: %w", manifest, err)
+	}
+
+	exempted := exemptions(object)
+	activation := map[string]interface{}{
+		"object": object,
+		"application": map[string]interface{}{
+			"name":      app.Metadata.Name,
+			"namespace": app.GetEffectiveNamespace(),
+			"project":   app.GetEffectiveProject(),
+			"labels":    labelsOf(app),
+		},
+	}
+
+	for _, rule := range e.rules {
+		if !rule.Match.matches(manifest, app.Metadata.Name, namespace) {
+			continue
+		}
+		if exempted["*"] || exempted[rule.Name] {
+			result.Exempted = append(result.Exempted, rule.Name)
+			continue
+		}
+
+		// An expression failing to evaluate, e.g. on a missing field, violates the rule
+		value, _, err := rule.program.Eval(activation)
+		if err != nil {
+			result.Violations = append(result.Violations, Violation{
+				Rule:     rule.Name,
+				Severity: rule.Severity,
+				Message:  fmt.Sprintf("failed to evaluate expression: %v", err),
+			})
+			continue
+		}
+
+		if passed, ok := value.Value().(bool); !ok || !passed {
+			result.Violations = append(result.Violations, Violation{
+				Rule:     rule.Name,
+				Severity: rule.Severity,
+				Message:  rule.message(),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// message returns the message reported for violations of the rule
+func (r compiledRule) message() string {
+	if r.Message != "" {
+		return r.Message
+	}
+	if r.Description != "" {
+		return r.Description
+	}
+	return "expression evaluated to false: " + r.Expression
+}
+
+// matches returns true if the match selects the resource
+func (m Match) matches(manifest hydrate.ManifestInfo, appName, namespace string) bool {
+	if len(m.Kinds) > 0 && !contains(m.Kinds, manifest.Kind) && !contains(m.Kinds, manifest.GroupKind()) {
+		return false
+	}
+	if len(m.Namespaces) > 0 && !matchesAny(m.Namespaces, namespace) {
+		return false
+	}
+	if len(m.Applications) > 0 && !matchesAny(m.Applications, appName) {
+		return false
+	}
+	return true
+}
+
+// exemptions returns the rule names listed in the exemption annotation of an object
+func exemptions(object map[string]interface{}) map[string]bool {
+	exempted := make(map[string]bool)
+
+	metadata, _ := object["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	value, _ := annotations[ExemptionAnnotation].(string)
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			exempted[name] = true
+		}
+	}
+	return exempted
+}
+
+// labelsOf returns the labels of an application as a CEL-compatible map
+func labelsOf(app application.Application) map[string]interface{} {
+	labels := make(map[string]interface{})
+	for key, value := range app.Metadata.Labels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// contains returns true if values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny returns true if value matches any of the glob patterns
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
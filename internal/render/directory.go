@@ -2,6 +2,7 @@ package render
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
@@ -11,7 +12,7 @@ import (
 )
 
 // ProcessDirectory processes a directory source
-func ProcessDirectory(source *application.Source) (string, error) {
+func ProcessDirectory(logger *slog.Logger, source *application.Source) (string, error) {
 	dirPath := source.Path
 
 	// Check if directory exists
@@ -49,8 +50,7 @@ func ProcessDirectory(source *application.Source) (string, error) {
 	// Sort the files for consistent output
 	sort.Strings(yamlFiles)
 
-	fmt.Printf("Processing %d YAML files from directory %s (recurse: %v)\n",
-		len(yamlFiles), dirPath, shouldRecurse)
+	logger.Info("Processing directory", "path", dirPath, "files", len(yamlFiles), "recurse", shouldRecurse)
 
 	var manifests []string
 	for _, file := range yamlFiles {
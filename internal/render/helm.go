@@ -1,38 +1,36 @@
 package render
 
 import (
-	"fmt"
+	"log/slog"
 	"strings"
 
 	"github.com/kazysgurskas/argocd-hydrate/internal/application"
 	"github.com/kazysgurskas/argocd-hydrate/internal/helm"
 )
 
-// ProcessHelmChart processes a Helm chart source
-func ProcessHelmChart(source *application.Source, appName, namespace string) (string, error) {
+// ProcessHelmChart processes a Helm chart source, returning the rendered manifests and the chart they were rendered from
+func ProcessHelmChart(logger *slog.Logger, client *helm.Client, source *application.Source, appName, namespace string) (string, *helm.ChartInfo, error) {
 	releaseName := source.GetEffectiveReleaseName(appName)
 
-	chartPath, err := helm.PullChart(source.RepoURL, source.Chart, source.TargetRevision)
+	chartPath, err := client.PullChart(logger, source.RepoURL, source.Chart, source.TargetRevision)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	var valueFilesPaths []string
-	for _, valueFile := range source.Helm.ValueFiles {
-		// Remove $values prefix if present
-		if strings.HasPrefix(valueFile, "$values/") {
-			valueFile = strings.Replace(valueFile, "$values/", "", 1)
-		}
-		valueFilesPaths = append(valueFilesPaths, valueFile)
+	chartInfo, err := helm.LoadChartInfo(chartPath)
+	if err != nil {
+		return "", nil, err
 	}
 
-	fmt.Printf("Rendering chart %s (version %s) with release name %s in namespace %s\n",
-		source.Chart, source.TargetRevision, releaseName, namespace)
+	valueFilesPaths := source.GetValueFiles()
+
+	logger.Info("Rendering chart", "chart", source.Chart, "version", source.TargetRevision,
+		"release", releaseName, "namespace", namespace)
 
-	renderedManifest, err := helm.RenderHelmChart(chartPath, releaseName, namespace, source.TargetRevision, valueFilesPaths)
+	renderedManifest, err := client.RenderHelmChart(logger, chartPath, releaseName, namespace, source.TargetRevision, valueFilesPaths)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	return strings.TrimSpace(renderedManifest), nil
+	return strings.TrimSpace(renderedManifest), chartInfo, nil
 }
@@ -0,0 +1,136 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/application"
+	"github.com/kazysgurskas/argocd-hydrate/internal/helm"
+	"github.com/kazysgurskas/argocd-hydrate/internal/plugin"
+)
+
+// unsafeParamChars matches the characters replaced by underscores in the PARAM_* variables of parameters
+var unsafeParamChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// ProcessPlugin processes a Config Management Plugin source, using the plugin it names or else the first whose
+// discovery rules match its directory. It returns the generated manifests and the name of the plugin
+func ProcessPlugin(logger *slog.Logger, registry *plugin.Registry, client *helm.Client, source *application.Source, app application.Application) (string, string, error) {
+	if registry.Empty() {
+		return "", "", fmt.Errorf("no Config Management Plugins are defined")
+	}
+
+	dirPath := source.Path
+	if dirPath == "" {
+		dirPath = "."
+	}
+	dirInfo, err := os.Stat(dirPath)
+	if err != nil || !dirInfo.IsDir() {
+		return "", "", fmt.Errorf("invalid directory path: %s: %w", dirPath, err)
+	}
+
+	env, err := pluginEnv(client, source, app)
+	if err != nil {
+		return "", "", err
+	}
+
+	var p *plugin.Plugin
+	if source.Plugin.Name != "" {
+		p, err = registry.Lookup(source.Plugin.Name)
+	} else {
+		p, err = registry.Discover(logger, dirPath, env)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	manifests, err := registry.Generate(logger, p, dirPath, env)
+	if err != nil {
+		return "", "", err
+	}
+
+	return strings.TrimSpace(manifests), p.Name(), nil
+}
+
+// pluginEnv returns the environment of plugin commands: the environment of this process, the ARGOCD_APP_*
+// build environment Argo CD provides, the variables of the source prefixed with ARGOCD_ENV_, and its parameters
+// as ARGOCD_APP_PARAMETERS and PARAM_* variables
+func pluginEnv(client *helm.Client, source *application.Source, app application.Application) ([]string, error) {
+	revision := GitRevision(source.Path)
+	shortRevision, shortRevision8 := revision, revision
+	if len(revision) > 7 {
+		shortRevision = revision[:7]
+	}
+	if len(revision) > 8 {
+		shortRevision8 = revision[:8]
+	}
+
+	build := map[string]string{
+		"ARGOCD_APP_NAME":                   app.Metadata.Name,
+		"ARGOCD_APP_NAMESPACE":              app.GetEffectiveNamespace(),
+		"ARGOCD_APP_PROJECT_NAME":           app.GetEffectiveProject(),
+		"ARGOCD_APP_REVISION":               revision,
+		"ARGOCD_APP_REVISION_SHORT":         shortRevision,
+		"ARGOCD_APP_REVISION_SHORT_8":       shortRevision8,
+		"ARGOCD_APP_SOURCE_PATH":            source.Path,
+		"ARGOCD_APP_SOURCE_REPO_URL":        source.RepoURL,
+		"ARGOCD_APP_SOURCE_TARGET_REVISION": source.TargetRevision,
+		"KUBE_VERSION":                      client.KubeVersion(),
+		"KUBE_API_VERSIONS":                 strings.Join(client.APIVersions(), ","),
+	}
+
+	env := os.Environ()
+	for name, value := range build {
+		env = append(env, name+"="+value)
+	}
+
+	// Like in Argo CD, the values of the source's variables may refer to the build environment
+	for _, entry := range source.Plugin.Env {
+		value := os.Expand(entry.Value, func(name string) string {
+			if value, ok := build[name]; ok {
+				return value
+			}
+			return "$" + name
+		})
+		env = append(env, "ARGOCD_ENV_"+entry.Name+"="+value)
+	}
+
+	if len(source.Plugin.Parameters) > 0 {
+		parameters, err := json.Marshal(source.Plugin.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal plugin parameters: %w", err)
+		}
+		env = append(env, "ARGOCD_APP_PARAMETERS="+string(parameters))
+	}
+	for _, parameter := range source.Plugin.Parameters {
+		name := "PARAM_" + strings.ToUpper(unsafeParamChars.ReplaceAllString(parameter.Name, "_"))
+		if parameter.String != nil {
+			env = append(env, name+"="+*parameter.String)
+		}
+		for i, item := range parameter.Array {
+			env = append(env, fmt.Sprintf("%s_%d=%s", name, i, item))
+		}
+		for key, value := range parameter.Map {
+			env = append(env, name+"_"+strings.ToUpper(unsafeParamChars.ReplaceAllString(key, "_"))+"="+value)
+		}
+	}
+
+	return env, nil
+}
+
+// GitRevision returns the commit checked out in the git repository containing dir, or an empty string
+// if it is not in one. Plugins get it as ARGOCD_APP_REVISION
+func GitRevision(dir string) string {
+	if dir == "" {
+		dir = "."
+	}
+	output, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
@@ -0,0 +1,199 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+	"github.com/kazysgurskas/argocd-hydrate/internal/index"
+)
+
+// Application statuses
+const (
+	StatusOK        = "ok"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+	StatusUnchanged = "unchanged"
+)
+
+// Report is the machine-readable description of a run
+type Report struct {
+	ToolVersion     string         `json:"toolVersion"`
+	KubeVersion     string         `json:"kubeVersion"`
+	StartedAt       time.Time      `json:"startedAt"`
+	DurationSeconds float64        `json:"durationSeconds"`
+	Applications    []*Application `json:"applications"`
+}
+
+// Application describes the result of hydrating a single application
+type Application struct {
+	Name            string     `json:"name"`
+	Status          string     `json:"status"`
+	Sources         []Source   `json:"sources,omitempty"`
+	Resources       []Resource `json:"resources,omitempty"`
+	Warnings        []string   `json:"warnings,omitempty"`
+	Errors          []string   `json:"errors,omitempty"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds"`
+}
+
+// Source describes a rendered source of an application
+type Source struct {
+	Type            string   `json:"type"`
+	RepoURL         string   `json:"repoURL,omitempty"`
+	Chart           string   `json:"chart,omitempty"`
+	TargetRevision  string   `json:"targetRevision,omitempty"`
+	ResolvedVersion string   `json:"resolvedVersion,omitempty"`
+	Digest          string   `json:"digest,omitempty"`
+	Plugin          string   `json:"plugin,omitempty"`
+	Path            string   `json:"path,omitempty"`
+	ValueFiles      []string `json:"valueFiles,omitempty"`
+}
+
+// Resource describes a rendered resource and the file it was written to
+type Resource struct {
+	Group     string `json:"group"`
+	Version   string `json:"version,omitempty"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Path      string `json:"path,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+}
+
+// Recorder collects the results of applications during a run and is safe for concurrent use
+type Recorder struct {
+	// mutex guards report and applications
+	mutex sync.Mutex
+
+	// report is the report being collected
+	report Report
+
+	// applications indexes the report's applications by name
+	applications map[string]*Application
+}
+
+// NewRecorder creates a recorder for a run over the given applications, all of which start out as skipped
+func NewRecorder(toolVersion, kubeVersion string, applications []string) *Recorder {
+	r := &Recorder{
+		report: Report{
+			ToolVersion: toolVersion,
+			KubeVersion: kubeVersion,
+			StartedAt:   time.Now().UTC(),
+		},
+		applications: make(map[string]*Application),
+	}
+
+	for _, name := range applications {
+		app := &Application{Name: name, Status: StatusSkipped}
+		r.report.Applications = append(r.report.Applications, app)
+		r.applications[name] = app
+	}
+	return r
+}
+
+// Record replaces the entry of an application with the given result
+func (r *Recorder) Record(app *Application) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if existing, ok := r.applications[app.Name]; ok {
+		*existing = *app
+		return
+	}
+	r.report.Applications = append(r.report.Applications, app)
+	r.applications[app.Name] = app
+}
+
+// AddWarning adds a warning to an application's entry
+func (r *Recorder) AddWarning(name, warning string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if app, ok := r.applications[name]; ok {
+		app.Warnings = append(app.Warnings, warning)
+	}
+}
+
+// Write stores the report as JSON in path
+func (r *Recorder) Write(path string) error {
+	r.mutex.Lock()
+	r.report.DurationSeconds = time.Since(r.report.StartedAt).Seconds()
+	content, err := json.MarshalIndent(r.report, "", "  ")
+	r.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	return nil
+}
+
+// Sources describes the rendered sources of a hydration result
+func Sources(result *hydrate.Result) []Source {
+	var sources []Source
+	for _, info := range result.Sources {
+		source := Source{
+			RepoURL:        info.Source.RepoURL,
+			TargetRevision: info.Source.TargetRevision,
+			Path:           info.Source.Path,
+			ValueFiles:     info.ValueFiles,
+		}
+
+		if info.Chart != nil {
+			source.Type = "helm"
+			source.Chart = info.Source.Chart
+			source.ResolvedVersion = info.Chart.Version
+			source.Digest = info.Chart.Digest
+		} else if info.Plugin != "" {
+			source.Type = "plugin"
+			source.Plugin = info.Plugin
+		} else {
+			source.Type = "directory"
+		}
+
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// NewResource describes a rendered manifest with the given key, written to path
+func NewResource(manifest hydrate.ManifestInfo, key index.Key, path string) Resource {
+	sum := sha256.Sum256([]byte(manifest.Content))
+
+	return Resource{
+		Group:     key.Group,
+		Version:   manifest.Version(),
+		Kind:      key.Kind,
+		Namespace: key.Namespace,
+		Name:      key.Name,
+		Path:      filepath.ToSlash(path),
+		Hash:      "sha256:" + hex.EncodeToString(sum[:]),
+	}
+}
+
+// Key returns the key of the resource
+func (r Resource) Key() index.Key {
+	return index.Key{Group: r.Group, Kind: r.Kind, Namespace: r.Namespace, Name: r.Name}
+}
+
+// ResourceFromKey describes a resource known only by its key, e.g. from a previous run's state
+func ResourceFromKey(key index.Key) Resource {
+	return Resource{
+		Group:     key.Group,
+		Kind:      key.Kind,
+		Namespace: key.Namespace,
+		Name:      key.Name,
+	}
+}
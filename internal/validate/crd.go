@@ -0,0 +1,155 @@
+package validate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+)
+
+// customResourceDefinition is the part of a CustomResourceDefinition describing the schemas of its versions
+type customResourceDefinition struct {
+	Spec struct {
+		Group string `yaml:"group"`
+		Names struct {
+			Kind string `yaml:"kind"`
+		} `yaml:"names"`
+		Versions []struct {
+			Name   string `yaml:"name"`
+			Schema struct {
+				OpenAPIV3Schema map[string]interface{} `yaml:"openAPIV3Schema"`
+			} `yaml:"schema"`
+		} `yaml:"versions"`
+	} `yaml:"spec"`
+}
+
+// crdKey returns the key of a custom resource schema
+func crdKey(group, version, kind string) string {
+	return group + "/" + version + "/" + kind
+}
+
+// AddCRDs adds the schemas of the CustomResourceDefinitions among manifests, so that their custom
+// resources are validated. Other manifests are ignored
+func (v *Validator) AddCRDs(manifests []hydrate.ManifestInfo) error {
+	for _, manifest := range manifests {
+		if manifest.GroupKind() != "CustomResourceDefinition.apiextensions.k8s.io" {
+			continue
+		}
+
+		var crd customResourceDefinition
+		if err := yaml.Unmarshal([]byte(manifest.Content), &crd); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", manifest, err)
+		}
+
+		for _, version := range crd.Spec.Versions {
+			if version.Schema.OpenAPIV3Schema == nil {
+				continue
+			}
+			key := crdKey(crd.Spec.Group, version.Name, crd.Spec.Names.Kind)
+			v.crds[key] = jsonSchema(version.Schema.OpenAPIV3Schema, true)
+			delete(v.schemas, key)
+		}
+	}
+	return nil
+}
+
+// LoadCRDs adds the schemas of the CustomResourceDefinitions in YAML files, or in the YAML files
+// below directories, at paths
+func (v *Validator) LoadCRDs(paths []string) error {
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || (path != root && !strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml")) {
+				return nil
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			manifests, err := hydrate.ParseManifests(string(content))
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+			return v.AddCRDs(manifests)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to load CRD schemas from %s: %w", root, err)
+		}
+	}
+	return nil
+}
+
+// jsonSchema converts a structural OpenAPI v3 schema of a CRD into a JSON schema, translating the Kubernetes
+// extensions gojsonschema does not know. The root of a custom resource also declares its type and object metadata
+func jsonSchema(schema map[string]interface{}, root bool) map[string]interface{} {
+	result := make(map[string]interface{}, len(schema))
+	for keyword, value := range schema {
+		switch keyword {
+		case "properties", "patternProperties":
+			properties := make(map[string]interface{})
+			if nested, ok := value.(map[string]interface{}); ok {
+				for name, property := range nested {
+					if propertySchema, ok := property.(map[string]interface{}); ok {
+						properties[name] = jsonSchema(propertySchema, false)
+					}
+				}
+			}
+			result[keyword] = properties
+		case "items", "additionalProperties", "not":
+			if nested, ok := value.(map[string]interface{}); ok {
+				result[keyword] = jsonSchema(nested, false)
+			} else {
+				result[keyword] = value
+			}
+		case "allOf", "anyOf", "oneOf":
+			var items []interface{}
+			if nested, ok := value.([]interface{}); ok {
+				for _, item := range nested {
+					if itemSchema, ok := item.(map[string]interface{}); ok {
+						items = append(items, jsonSchema(itemSchema, false))
+					}
+				}
+			}
+			result[keyword] = items
+		default:
+			result[keyword] = value
+		}
+	}
+
+	// An int-or-string field holds either, and a nullable field may also be null
+	if schema["x-kubernetes-int-or-string"] == true {
+		result["type"] = []interface{}{"integer", "string"}
+	}
+	if schema["nullable"] == true {
+		if schemaType, ok := result["type"].(string); ok {
+			result["type"] = []interface{}{schemaType, "null"}
+		} else if types, ok := result["type"].([]interface{}); ok {
+			result["type"] = append(types, "null")
+		}
+	}
+
+	if root {
+		properties, _ := result["properties"].(map[string]interface{})
+		if properties == nil {
+			properties = make(map[string]interface{})
+			result["properties"] = properties
+		}
+		for _, field := range []string{"apiVersion", "kind"} {
+			if _, ok := properties[field]; !ok {
+				properties[field] = map[string]interface{}{"type": "string"}
+			}
+		}
+		// Object metadata is validated by the API server against ObjectMeta, whatever the CRD declares
+		properties["metadata"] = map[string]interface{}{"type": "object"}
+	}
+
+	return result
+}
@@ -0,0 +1,212 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kazysgurskas/argocd-hydrate/internal/hydrate"
+)
+
+// Result is the outcome of validating a manifest
+type Result struct {
+	// Missing is true if there is no schema for the manifest's kind, in which case it was not validated
+	Missing bool
+
+	// Errors describes every violation of the schema
+	Errors []string
+}
+
+// Valid returns true if the manifest was validated without errors
+func (r Result) Valid() bool {
+	return !r.Missing && len(r.Errors) == 0
+}
+
+// Validator validates manifests against Kubernetes JSON schemas, read from a local schema directory for
+// built-in kinds and from CustomResourceDefinitions for custom resources, without any network access
+type Validator struct {
+	// schemaDir is the directory holding JSON schemas in the layout of kubernetes-json-schema, e.g.
+	// v1.31.1-standalone/deployment-apps-v1.json; built-in kinds have no schema when it is empty
+	schemaDir string
+
+	// strict rejects fields that are not declared in the schema
+	strict bool
+
+	// crds holds the schemas of custom resources, keyed by group/version/Kind
+	crds map[string]map[string]interface{}
+
+	// schemas caches compiled schemas, keyed by the schema file path or custom resource key
+	schemas map[string]*gojsonschema.Schema
+}
+
+// NewValidator creates a validator using the JSON schemas in schemaDir. In strict mode, fields
+// that are not declared in the schema are errors, unless the schema preserves unknown fields
+func NewValidator(schemaDir string, strict bool) *Validator {
+	return &Validator{
+		schemaDir: schemaDir,
+		strict:    strict,
+		crds:      make(map[string]map[string]interface{}),
+		schemas:   make(map[string]*gojsonschema.Schema),
+	}
+}
+
+// Validate validates a manifest against the schema of its kind for the given Kubernetes version
+func (v *Validator) Validate(manifest hydrate.ManifestInfo, kubeVersion string) (Result, error) {
+	schema, err := v.schema(manifest, kubeVersion)
+	if err != nil {
+		return Result{}, err
+	}
+	if schema == nil {
+		return Result{Missing: true}, nil
+	}
+
+	// Convert through JSON like the API server does, so that e.g. timestamps stay strings
+	document, err := yaml.YAMLToJSON([]byte(manifest.Content))
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to convert %s to JSON: %w", manifest, err)
+	}
+
+	validation, err := schema.Validate(gojsonschema.NewBytesLoader(document))
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to validate %s: %w", manifest, err)
+	}
+
+	var result Result
+	for _, problem := range validation.Errors() {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", problem.Field(), problem.Description()))
+	}
+	return result, nil
+}
+
+// schema returns the compiled schema of a manifest's kind, or nil if there is none.
+// Custom resource schemas take precedence over the schema directory
+func (v *Validator) schema(manifest hydrate.ManifestInfo, kubeVersion string) (*gojsonschema.Schema, error) {
+	key := crdKey(manifest.Group(), manifest.Version(), manifest.Kind)
+	if crdSchema, ok := v.crds[key]; ok {
+		return v.compile(key, crdSchema)
+	}
+
+	path, err := v.schemaFile(manifest, kubeVersion)
+	if err != nil || path == "" {
+		return nil, err
+	}
+	if schema, ok := v.schemas[path]; ok {
+		return schema, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %s: %w", path, err)
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse schema %s: %w", path, err)
+	}
+
+	return v.compile(path, document)
+}
+
+// schemaFile returns the path of the schema of a manifest's kind in the schema directory, or an empty string
+// if there is none. Strict mode prefers the -standalone-strict variant of the directory, though any schema is
+// made strict when compiled
+func (v *Validator) schemaFile(manifest hydrate.ManifestInfo, kubeVersion string) (string, error) {
+	if v.schemaDir == "" {
+		return "", nil
+	}
+
+	// Schema files are named after the lowercase kind, the first label of the group and the version
+	name := strings.ToLower(manifest.Kind)
+	if group := manifest.Group(); group != "" {
+		name += "-" + strings.Split(group, ".")[0]
+	}
+	name += "-" + manifest.Version() + ".json"
+
+	versionDir := "v" + strings.TrimPrefix(kubeVersion, "v")
+	candidates := []string{versionDir + "-standalone"}
+	if v.strict {
+		candidates = append([]string{versionDir + "-standalone-strict"}, candidates...)
+	}
+
+	for _, dir := range candidates {
+		path := filepath.Join(v.schemaDir, dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to find schema %s: %w", path, err)
+		}
+	}
+	return "", nil
+}
+
+// HasSchemas returns true if the schema directory holds schemas of built-in kinds for a Kubernetes version
+func (v *Validator) HasSchemas(kubeVersion string) bool {
+	if v.schemaDir == "" {
+		return false
+	}
+
+	versionDir := "v" + strings.TrimPrefix(kubeVersion, "v")
+	for _, dir := range []string{versionDir + "-standalone", versionDir + "-standalone-strict"} {
+		if info, err := os.Stat(filepath.Join(v.schemaDir, dir)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// compile compiles a schema document, caching it under key
+func (v *Validator) compile(key string, document map[string]interface{}) (*gojsonschema.Schema, error) {
+	if schema, ok := v.schemas[key]; ok {
+		return schema, nil
+	}
+
+	if v.strict {
+		disallowUnknownFields(document)
+	}
+
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(document))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema %s: %w", key, err)
+	}
+	v.schemas[key] = schema
+	return schema, nil
+}
+
+// disallowUnknownFields closes every object schema that declares its properties, so that undeclared
+// fields fail validation. Schemas that preserve unknown fields or set additionalProperties are left open
+func disallowUnknownFields(schema map[string]interface{}) {
+	_, hasProperties := schema["properties"]
+	_, hasAdditional := schema["additionalProperties"]
+	if hasProperties && !hasAdditional && schema["x-kubernetes-preserve-unknown-fields"] != true {
+		schema["additionalProperties"] = false
+	}
+
+	// Descend into every nested schema
+	for _, keyword := range []string{"properties", "patternProperties", "definitions"} {
+		if nested, ok := schema[keyword].(map[string]interface{}); ok {
+			for _, property := range nested {
+				if propertySchema, ok := property.(map[string]interface{}); ok {
+					disallowUnknownFields(propertySchema)
+				}
+			}
+		}
+	}
+	for _, keyword := range []string{"items", "additionalProperties", "not"} {
+		if nested, ok := schema[keyword].(map[string]interface{}); ok {
+			disallowUnknownFields(nested)
+		}
+	}
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		if nested, ok := schema[keyword].([]interface{}); ok {
+			for _, item := range nested {
+				if itemSchema, ok := item.(map[string]interface{}); ok {
+					disallowUnknownFields(itemSchema)
+				}
+			}
+		}
+	}
+}
@@ -1,7 +1,13 @@
 package util
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -36,15 +42,25 @@ func MergeMaps(dest, src map[string]interface{}) {
 	}
 }
 
-// SanitizeFileName makes sure a string is valid as a filename
+// SanitizeFileName makes sure a string is valid as a filename. Letters, digits, '-', '_' and '.' are kept
+// as they are, any other byte (and a leading '.') is escaped as %XX, so distinct names never map to the same filename
 func SanitizeFileName(name string) string {
-	// Replace characters that might not be valid in filenames
-	name = strings.ReplaceAll(name, ":", "-")
-	name = strings.ReplaceAll(name, "/", "-")
-	name = strings.ReplaceAll(name, "\\", "-")
-	name = strings.ReplaceAll(name, ".", "-")
-	name = strings.ReplaceAll(name, " ", "-")
-	return name
+	var sanitized strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if isFileNameChar(c) && !(i == 0 && c == '.') {
+			sanitized.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sanitized, "%%%02X", c)
+		}
+	}
+	return sanitized.String()
+}
+
+// isFileNameChar returns true if the byte is safe to use in a filename on all common filesystems
+func isFileNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		c == '-' || c == '_' || c == '.'
 }
 
 // GetNestedString safely extracts a string value from a nested map
@@ -57,3 +73,125 @@ func GetNestedString(obj map[string]interface{}, key string) (string, bool) {
 	str, ok := val.(string)
 	return str, ok
 }
+
+// HashDirectory returns the sha256 digest of the relative paths and contents of all files under root. Git
+// metadata and the directories in excluded, e.g. caches and output written by the tool itself, are skipped.
+// Symlinks to directories are followed like files are read through symlinks, except for those leading back
+// to a directory being hashed, of which only the link target is hashed
+func HashDirectory(root string, excluded ...string) (string, error) {
+	skipped := make(map[string]bool)
+	for _, dir := range excluded {
+		if dir == "" {
+			continue
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return "", err
+		}
+		skipped[abs] = true
+	}
+
+	h := sha256.New()
+	if err := hashTree(h, root, "", skipped, make(map[string]bool)); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashTree writes the paths and contents of the files under dir to h, with their paths relative to dir and
+// prefixed with prefix. followed holds the resolved directories whose trees are being hashed, to detect cycles
+func hashTree(h hash.Hash, dir, prefix string, skipped, followed map[string]bool) error {
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	followed[resolvedDir] = true
+	defer delete(followed, resolvedDir)
+
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if entry.Name() == ".git" {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil && skipped[abs] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(filepath.Join(prefix, relPath))
+
+		if entry.Type()&fs.ModeSymlink != 0 {
+			info, statErr := os.Stat(path)
+			if statErr == nil && info.IsDir() {
+				target, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return err
+				}
+				if !leadsBack(target, filepath.Dir(path), followed) {
+					return hashTree(h, target, relPath, skipped, followed)
+				}
+			}
+
+			// Hash where cyclic and dangling links point instead of following them
+			if statErr != nil || info.IsDir() {
+				link, err := os.Readlink(path)
+				if err != nil {
+					return err
+				}
+				writeHashField(h, relPath, []byte("symlink:"+link))
+				return nil
+			}
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		writeHashField(h, relPath, content)
+		return nil
+	})
+}
+
+// leadsBack returns true if a symlink to the directory target, located in parent, leads to one of the
+// directories containing it, which would make following it an endless loop
+func leadsBack(target, parent string, followed map[string]bool) bool {
+	resolvedParent, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return true
+	}
+
+	contains := func(dir, path string) bool {
+		return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+	}
+	if contains(target, resolvedParent) {
+		return true
+	}
+	for dir := range followed {
+		if contains(target, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeHashField writes a length-prefixed path and content to h, so that paths and contents cannot run into
+// each other
+func writeHashField(h hash.Hash, path string, content []byte) {
+	fmt.Fprintf(h, "%d:%s%d:", len(path), path, len(content))
+	h.Write(content)
+}